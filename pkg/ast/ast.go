@@ -2,7 +2,9 @@ package ast
 
 import (
 	"bytes"
+	"cmp"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -17,9 +19,18 @@ type Node interface {
 // All statement nodes implement this
 type Statement interface {
 	Node
+	GetComments() *CommentGroup
 	statementNode()
 }
 
+// CommentGroup holds the comments attached to a statement.
+type CommentGroup struct {
+	Leading  []token.Token // comments on their own lines just before the statement
+	Trailing []token.Token // the comment ending the statement's last line
+}
+
+func (cg *CommentGroup) GetComments() *CommentGroup { return cg }
+
 type Block interface {
 	GetStatements() []Statement
 }
@@ -32,14 +43,27 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	Dangling   []token.Token // comments after the last statement
 }
 
 type ActionBlock struct {
 	Statements []Statement
+	Rbrace     token.Token   // the closing }
+	Dangling   []token.Token // comments after the { or the last statement that no statement claims
 }
 
 func (ab *ActionBlock) GetStatements() []Statement { return ab.Statements }
-func (ab *ActionBlock) String() string             { return "" }
+func (ab *ActionBlock) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("{\n")
+	for _, s := range ab.Statements {
+		out.WriteString(s.String() + "\n")
+	}
+	out.WriteString("}")
+
+	return out.String()
+}
 
 func (p *Program) GetToken() token.Token {
 	if len(p.Statements) > 0 {
@@ -62,6 +86,7 @@ func (p *Program) String() string {
 type ExpressionStatement struct {
 	Token       token.Token // the first token of the expression
 	Expressions []Expression
+	CommentGroup
 }
 
 func (es *ExpressionStatement) statementNode()        {}
@@ -80,6 +105,7 @@ type ActionBlockStatement struct {
 	Token      token.Token // the { token
 	Conditon   Expression
 	Statements *ActionBlock
+	CommentGroup
 }
 
 func (as *ActionBlockStatement) statementNode()             {}
@@ -98,6 +124,9 @@ func (as *ActionBlockStatement) String() string {
 type BeginStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Rbrace     token.Token   // the closing }
+	Dangling   []token.Token // comments after the { or the last statement that no statement claims
+	CommentGroup
 }
 
 func (bs *BeginStatement) statementNode()             {}
@@ -118,6 +147,9 @@ func (bs *BeginStatement) String() string {
 type EndStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Rbrace     token.Token   // the closing }
+	Dangling   []token.Token // comments after the { or the last statement that no statement claims
+	CommentGroup
 }
 
 func (es *EndStatement) statementNode()             {}
@@ -137,6 +169,7 @@ type AssignStatement struct {
 	Token   token.Token // the { token
 	Targets []Expression
 	Values  []Expression
+	CommentGroup
 }
 
 func (as *AssignStatement) statementNode()        {}
@@ -151,26 +184,12 @@ func (as *AssignStatement) String() string {
 	return out.String()
 }
 
-type AssignAndModifyStatement struct {
-	Token    token.Token // the { token
-	Operator token.Token
-	Target   Expression
-	Value    Expression
-}
-
-func (ams *AssignAndModifyStatement) statementNode()        {}
-func (ams *AssignAndModifyStatement) GetToken() token.Token { return ams.Token }
-func (ams *AssignAndModifyStatement) String() string {
-	var out bytes.Buffer
-
-	out.WriteString(ams.Target.String() + " " + ams.Operator.Literal + " " + ams.Value.String())
-
-	return out.String()
-}
-
 type PrintStatement struct {
 	Token       token.Token // the print token
 	Expressions []Expression
+	Redirect    token.Token // >, >> or |, or the zero Token when printing to the output
+	Destination Expression  // the file or command printed to when Redirect is set
+	CommentGroup
 }
 
 func (ps *PrintStatement) statementNode()        {}
@@ -185,6 +204,9 @@ func (ps *PrintStatement) String() string {
 			out.WriteString(",")
 		}
 	}
+	if ps.Destination != nil {
+		out.WriteString(" " + ps.Redirect.Literal + " " + ps.Destination.String())
+	}
 
 	return out.String()
 }
@@ -194,6 +216,7 @@ type IfStatement struct {
 	Conditions   []Expression
 	Consequences []*ActionBlock
 	Else         *ActionBlock
+	CommentGroup
 }
 
 func (is *IfStatement) statementNode()        {}
@@ -205,11 +228,10 @@ func (is *IfStatement) String() string {
 }
 
 type WhileStatement struct {
-	Token          token.Token
-	Condition      Expression
-	Block          *ActionBlock
-	ShouldBreak    bool
-	ShouldContinue bool
+	Token     token.Token
+	Condition Expression
+	Block     *ActionBlock
+	CommentGroup
 }
 
 func (ws *WhileStatement) statementNode()        {}
@@ -221,11 +243,10 @@ func (ws *WhileStatement) String() string {
 }
 
 type DoWhileStatement struct {
-	Token          token.Token
-	Condition      Expression
-	Block          *ActionBlock
-	ShouldBreak    bool
-	ShouldContinue bool
+	Token     token.Token
+	Condition Expression
+	Block     *ActionBlock
+	CommentGroup
 }
 
 func (ds *DoWhileStatement) statementNode()        {}
@@ -242,8 +263,7 @@ type ForStatement struct {
 	Condition      Expression
 	Action         Statement
 	Block          *ActionBlock
-	ShouldBreak    bool
-	ShouldContinue bool
+	CommentGroup
 }
 
 func (fs *ForStatement) statementNode()        {}
@@ -255,12 +275,11 @@ func (fs *ForStatement) String() string {
 }
 
 type ForEachStatement struct {
-	Token          token.Token
-	VarName        *Identifier
-	Array          *Identifier
-	Block          *ActionBlock
-	ShouldBreak    bool
-	ShouldContinue bool
+	Token   token.Token
+	VarName *Identifier
+	Array   Expression // an Identifier, or an ArrayIndexExpression for a subarray
+	Block   *ActionBlock
+	CommentGroup
 }
 
 func (fs *ForEachStatement) statementNode()        {}
@@ -274,6 +293,7 @@ func (fs *ForEachStatement) String() string {
 type ReturnStatement struct {
 	Token token.Token
 	Value Expression
+	CommentGroup
 }
 
 func (cs *ReturnStatement) statementNode()        {}
@@ -286,6 +306,7 @@ func (cs *ReturnStatement) String() string {
 
 type BreakStatement struct {
 	Token token.Token
+	CommentGroup
 }
 
 func (bs *BreakStatement) statementNode()        {}
@@ -301,6 +322,7 @@ type FunctionLiteral struct {
 	Name       Identifier
 	Parameters []Identifier
 	Body       *ActionBlock
+	CommentGroup
 }
 
 func (fl *FunctionLiteral) statementNode()        {}
@@ -324,6 +346,7 @@ func (fl *FunctionLiteral) String() string {
 
 type ContinueStatement struct {
 	Token token.Token
+	CommentGroup
 }
 
 func (cs *ContinueStatement) statementNode()        {}
@@ -336,6 +359,7 @@ func (cs *ContinueStatement) String() string {
 
 type NextStatement struct {
 	Token token.Token
+	CommentGroup
 }
 
 func (ns *NextStatement) statementNode()        {}
@@ -372,6 +396,53 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// GetlineExpression reads a line from a file with getline < file, or from
+// the output of a command with cmd | getline.
+type GetlineExpression struct {
+	Token   token.Token // the getline token
+	Target  Expression  // the variable read into, nil for $0
+	File    Expression
+	Command Expression
+}
+
+func (ge *GetlineExpression) expressionNode()       {}
+func (ge *GetlineExpression) GetToken() token.Token { return ge.Token }
+func (ge *GetlineExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	if ge.Command != nil {
+		out.WriteString(ge.Command.String() + " | ")
+	}
+	out.WriteString("getline")
+	if ge.Target != nil {
+		out.WriteString(" " + ge.Target.String())
+	}
+	if ge.File != nil {
+		out.WriteString(" < " + ge.File.String())
+	}
+	out.WriteString(")")
+	return out.String()
+}
+
+type AssignExpression struct {
+	Token    token.Token // the assignment operator token, e.g. = or +=
+	Operator token.Token
+	Target   Expression
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode()       {}
+func (ae *AssignExpression) GetToken() token.Token { return ae.Token }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String() + " " + ae.Operator.Literal + " " + ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type TernaryExpression struct {
 	Token     token.Token // The '(' token
 	Condition Expression
@@ -384,7 +455,9 @@ func (te *TernaryExpression) GetToken() token.Token { return te.Token }
 func (te *TernaryExpression) String() string {
 	var out bytes.Buffer
 
+	out.WriteString("(")
 	out.WriteString(te.Condition.String() + " ? " + te.IfTrue.String() + " : " + te.IfFalse.String())
+	out.WriteString(")")
 
 	return out.String()
 }
@@ -464,11 +537,15 @@ type NumericLiteral struct {
 
 func (il *NumericLiteral) expressionNode()       {}
 func (il *NumericLiteral) GetToken() token.Token { return il.Token }
-func (il *NumericLiteral) String() string {
-	if il.Value == float64(int(il.Value)) {
-		return fmt.Sprintf("%d", int(il.Value))
+func (il *NumericLiteral) String() string        { return FormatNumber(il.Value) }
+
+// FormatNumber converts a number to a string the way printing it does:
+// integers in full, anything else to 5 significant digits.
+func FormatNumber(f float64) string {
+	if f == float64(int(f)) {
+		return strconv.Itoa(int(f))
 	}
-	return fmt.Sprintf("%.5g", il.Value)
+	return fmt.Sprintf("%.5g", f)
 }
 
 type StringLiteral struct {
@@ -500,6 +577,61 @@ func (rl *RegexLiteral) String() string        { return rl.Value }
 type AssociativeArray struct {
 	Token token.Token
 	Array map[string]Expression
+
+	inserted map[string]int // position each key was added at, for iterating in insertion order
+	count    int
+}
+
+func NewAssociativeArray() *AssociativeArray {
+	return &AssociativeArray{Array: make(map[string]Expression)}
+}
+
+// Set stores an element, remembering when the key was first added.
+func (aa *AssociativeArray) Set(key string, value Expression) {
+	if aa.Array == nil {
+		aa.Array = make(map[string]Expression)
+	}
+	if aa.inserted == nil {
+		aa.inserted = make(map[string]int)
+	}
+	if _, ok := aa.inserted[key]; !ok {
+		aa.inserted[key] = aa.count
+		aa.count++
+	}
+	aa.Array[key] = value
+}
+
+func (aa *AssociativeArray) Delete(key string) {
+	delete(aa.Array, key)
+	delete(aa.inserted, key)
+}
+
+func (aa *AssociativeArray) Clear() {
+	clear(aa.Array)
+	clear(aa.inserted)
+}
+
+// Keys returns the keys of the array in the order they were added.
+func (aa *AssociativeArray) Keys() []string {
+	keys := make([]string, 0, len(aa.Array))
+	for k := range aa.Array {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		ai, aok := aa.inserted[a]
+		bi, bok := aa.inserted[b]
+		switch {
+		case aok && bok:
+			return cmp.Compare(ai, bi)
+		case aok:
+			return -1
+		case bok:
+			return 1
+		default:
+			return strings.Compare(a, b)
+		}
+	})
+	return keys
 }
 
 func (aa *AssociativeArray) expressionNode()       {}
@@ -507,8 +639,8 @@ func (aa *AssociativeArray) GetToken() token.Token { return aa.Token }
 func (aa *AssociativeArray) String() string {
 	var out bytes.Buffer
 	entries := []string{}
-	for k, v := range aa.Array {
-		entries = append(entries, k+" : "+v.String())
+	for _, k := range aa.Keys() {
+		entries = append(entries, k+" : "+aa.Array[k].String())
 	}
 
 	out.WriteString("{")
@@ -522,6 +654,7 @@ type ArrayIndexExpression struct {
 	Token     token.Token
 	ArrayName string
 	IndexList []Expression
+	Parent    *ArrayIndexExpression // the element holding this one for a[i][j], nil for a[i]
 }
 
 func (aie *ArrayIndexExpression) expressionNode()       {}
@@ -533,19 +666,33 @@ func (aie *ArrayIndexExpression) String() string {
 	for _, i := range aie.IndexList {
 		indicies = append(indicies, i.String())
 	}
-	out.WriteString(aie.ArrayName + "[" + strings.Join(indicies, ", ") + "]")
+	if aie.Parent != nil {
+		out.WriteString(aie.Parent.String())
+	} else {
+		out.WriteString(aie.ArrayName)
+	}
+	out.WriteString("[" + strings.Join(indicies, ", ") + "]")
 
 	return out.String()
 }
 
+type FieldExpression struct {
+	Token token.Token // the $ token
+	Index Expression
+}
+
+func (fe *FieldExpression) expressionNode()       {}
+func (fe *FieldExpression) GetToken() token.Token { return fe.Token }
+func (fe *FieldExpression) String() string        { return "$" + fe.Index.String() }
+
 type DeleteStatement struct {
 	Token    token.Token
-	ToDelete *ArrayIndexExpression
+	ToDelete Expression // an ArrayIndexExpression, or an Identifier to delete every element
+	CommentGroup
 }
 
 func (ds *DeleteStatement) statementNode()        {}
 func (ds *DeleteStatement) GetToken() token.Token { return ds.Token }
 func (ds *DeleteStatement) String() string {
-	var out bytes.Buffer
-	return out.String()
+	return "delete " + ds.ToDelete.String()
 }
@@ -1,7 +1,21 @@
 package flags
 
+import "time"
+
 var Flags struct {
 	ProgramFile string   `arg:"-f" placeholder:"PROGRAMFILE" help:"Program File to run."`
 	Program     string   `arg:"positional" help:"Program to run."`
 	InputFiles  []string `arg:"positional" placeholder:"INPUTFILE" help:"File to use as input."`
+	Seed        int64    `arg:"--seed" help:"Seed for the random number generator used by rand()."`
+	Sandbox     bool     `arg:"--sandbox" help:"Disable system(), command pipes and file redirection."`
+	Lint        bool     `arg:"--lint" help:"Report likely bugs in the program without running it."`
+	Fmt         bool     `arg:"--fmt" help:"Print the program in canonical layout instead of running it."`
+	Write       bool     `arg:"-w" help:"With --fmt, write the result to the program file instead."`
+
+	MaxSteps        int           `arg:"--max-steps" help:"Stop after executing this many statements, loop iterations and function calls."`
+	Timeout         time.Duration `arg:"--timeout" help:"Stop after running for this long, e.g. 5s."`
+	MaxOutputBytes  int           `arg:"--max-output" help:"Stop after printing this many bytes."`
+	MaxArraySize    int           `arg:"--max-array-size" help:"Stop when an array grows past this many elements."`
+	MaxStringLength int           `arg:"--max-string-length" help:"Stop when a string grows past this many bytes."`
+	MaxCallDepth    int           `arg:"--max-call-depth" help:"Stop when function calls nest deeper than this."`
 }
@@ -0,0 +1,462 @@
+// Package format prints strawk programs in a canonical layout, keeping their
+// comments.
+package format
+
+import (
+	"strings"
+
+	"github.com/ahalbert/strawk/pkg/ast"
+	"github.com/ahalbert/strawk/pkg/lexer"
+	"github.com/ahalbert/strawk/pkg/parser"
+	"github.com/ahalbert/strawk/pkg/strawk"
+	"github.com/ahalbert/strawk/pkg/token"
+)
+
+const indent = "  "
+
+// Source formats a program, returning a *strawk.ParseError if it does not
+// parse.
+func Source(src string) (string, error) {
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors) > 0 {
+		return "", &strawk.ParseError{Errors: p.Errors}
+	}
+	if program == nil {
+		return "", &strawk.ParseError{Errors: []string{"Parse Error on line 1: the program could not be parsed\n\n"}}
+	}
+	return Program(program), nil
+}
+
+// Program prints a parsed program with the comments the parser attached to
+// it. Blank lines between statements are kept, but never more than one.
+func Program(program *ast.Program) string {
+	p := &printer{blockStart: true}
+	for _, stmt := range program.Statements {
+		p.statement(stmt)
+	}
+	p.comments(program.Dangling)
+	return p.out.String()
+}
+
+type printer struct {
+	out        strings.Builder
+	depth      int
+	lastLine   int  // source line of the last thing printed
+	blockStart bool // nothing has been printed in the current block yet
+	inPrint    bool // > and | would redirect the output of a print statement
+}
+
+// line starts a new line of output for something on a line of the source,
+// keeping a blank line that separated it from what came before.
+func (p *printer) line(line int) {
+	if !p.blockStart && line > p.lastLine+1 {
+		p.out.WriteString("\n")
+	}
+	p.blockStart = false
+	p.out.WriteString(strings.Repeat(indent, p.depth))
+	p.lastLine = max(p.lastLine, line)
+}
+
+// comments prints comments on lines of their own.
+func (p *printer) comments(comments []token.Token) {
+	for _, comment := range comments {
+		p.line(comment.LineNum)
+		p.out.WriteString(comment.Literal + "\n")
+	}
+}
+
+// endLine ends a line of output that ended on line of the source, with the
+// comments that followed it there.
+func (p *printer) endLine(line int, trailing []token.Token) {
+	for _, comment := range trailing {
+		p.out.WriteString(" " + comment.Literal)
+	}
+	p.out.WriteString("\n")
+	p.lastLine = max(p.lastLine, line)
+}
+
+// block prints a block after its opening line, which is on line of the
+// source, up to its } without ending the line. Comments in the block that no
+// statement claimed stay after the { if they were on its line, and otherwise
+// go before the }.
+func (p *printer) block(line int, statements []ast.Statement, rbrace token.Token, dangling []token.Token) {
+	var trailing, rest []token.Token
+	for _, comment := range dangling {
+		if comment.LineNum == line {
+			trailing = append(trailing, comment)
+		} else {
+			rest = append(rest, comment)
+		}
+	}
+	p.out.WriteString(" {")
+	p.endLine(line, trailing)
+	p.depth++
+	p.blockStart = true
+	for _, stmt := range statements {
+		p.statement(stmt)
+	}
+	p.comments(rest)
+	p.depth--
+	p.blockStart = false
+	p.out.WriteString(strings.Repeat(indent, p.depth) + "}")
+	p.lastLine = max(p.lastLine, rbrace.LineNum)
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	if stmt == nil {
+		return
+	}
+	line := stmt.GetToken().LineNum
+	p.comments(stmt.GetComments().Leading)
+	p.line(line)
+	end := line
+	switch stmt := stmt.(type) {
+	case *ast.FunctionLiteral:
+		p.out.WriteString("function " + stmt.Name.Value + "(" + parameters(stmt.Parameters) + ")")
+		p.block(line, stmt.Body.Statements, stmt.Body.Rbrace, stmt.Body.Dangling)
+		end = stmt.Body.Rbrace.LineNum
+	case *ast.BeginStatement:
+		p.out.WriteString("BEGIN")
+		p.block(line, stmt.Statements, stmt.Rbrace, stmt.Dangling)
+		end = stmt.Rbrace.LineNum
+	case *ast.EndStatement:
+		p.out.WriteString("END")
+		p.block(line, stmt.Statements, stmt.Rbrace, stmt.Dangling)
+		end = stmt.Rbrace.LineNum
+	case *ast.ActionBlockStatement:
+		if rule, ok := stmt.Conditon.(*ast.InfixExpression); ok && rule.Operator == "~$0" {
+			p.out.WriteString(p.expression(rule.Right))
+		} else {
+			p.out.WriteString(p.expression(stmt.Conditon))
+		}
+		p.block(line, stmt.Statements.Statements, stmt.Statements.Rbrace, stmt.Statements.Dangling)
+		end = stmt.Statements.Rbrace.LineNum
+	case *ast.IfStatement:
+		for idx, condition := range stmt.Conditions {
+			if idx > 0 {
+				p.out.WriteString(" else ")
+			}
+			p.out.WriteString("if (" + p.expression(condition) + ")")
+			p.block(p.lastLine, stmt.Consequences[idx].Statements, stmt.Consequences[idx].Rbrace, stmt.Consequences[idx].Dangling)
+			end = stmt.Consequences[idx].Rbrace.LineNum
+		}
+		if stmt.Else != nil {
+			p.out.WriteString(" else")
+			p.block(p.lastLine, stmt.Else.Statements, stmt.Else.Rbrace, stmt.Else.Dangling)
+			end = stmt.Else.Rbrace.LineNum
+		}
+	case *ast.WhileStatement:
+		p.out.WriteString("while (" + p.expression(stmt.Condition) + ")")
+		p.block(line, stmt.Block.Statements, stmt.Block.Rbrace, stmt.Block.Dangling)
+		end = stmt.Block.Rbrace.LineNum
+	case *ast.DoWhileStatement:
+		p.out.WriteString("do")
+		p.block(line, stmt.Block.Statements, stmt.Block.Rbrace, stmt.Block.Dangling)
+		p.out.WriteString(" while (" + p.expression(stmt.Condition) + ")")
+		end = stmt.Block.Rbrace.LineNum
+	case *ast.ForStatement:
+		var condition string
+		if stmt.Condition != nil {
+			condition = p.expression(stmt.Condition)
+		}
+		p.out.WriteString("for (" + p.simpleStatement(stmt.Initialization) + "; " + condition + "; " + p.simpleStatement(stmt.Action) + ")")
+		p.block(line, stmt.Block.Statements, stmt.Block.Rbrace, stmt.Block.Dangling)
+		end = stmt.Block.Rbrace.LineNum
+	case *ast.ForEachStatement:
+		p.out.WriteString("for (" + stmt.VarName.Value + " in " + p.expression(stmt.Array) + ")")
+		p.block(line, stmt.Block.Statements, stmt.Block.Rbrace, stmt.Block.Dangling)
+		end = stmt.Block.Rbrace.LineNum
+	default:
+		p.out.WriteString(p.simpleStatement(stmt))
+	}
+	p.endLine(end, stmt.GetComments().Trailing)
+}
+
+// parameters lists the parameters of a function. By convention, extra spaces
+// set apart the ones used as local variables; that gap is kept as four spaces.
+func parameters(params []ast.Identifier) string {
+	var out strings.Builder
+	for idx, param := range params {
+		if idx > 0 {
+			prev := params[idx-1].Token
+			out.WriteString(",")
+			if param.Token.LineNum == prev.LineNum && param.Token.Position > prev.Position+len(prev.Literal)+2 {
+				out.WriteString("    ")
+			} else {
+				out.WriteString(" ")
+			}
+		}
+		out.WriteString(param.Value)
+	}
+	return out.String()
+}
+
+// simpleStatement prints a statement that has no block.
+func (p *printer) simpleStatement(stmt ast.Statement) string {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		return p.expressionList(stmt.Expressions)
+	case *ast.AssignStatement:
+		return p.expressionList(stmt.Targets) + " = " + p.expressionList(stmt.Values)
+	case *ast.PrintStatement:
+		out := "print"
+		if len(stmt.Expressions) > 0 {
+			p.inPrint = true
+			out += " " + p.expressionList(stmt.Expressions)
+			p.inPrint = false
+		}
+		if stmt.Destination != nil {
+			out += " " + stmt.Redirect.Literal + " " + p.operand(stmt.Destination, parser.EQUALITY+1)
+		}
+		return out
+	case *ast.DeleteStatement:
+		return "delete " + p.expression(stmt.ToDelete)
+	case *ast.ReturnStatement:
+		if stmt.Value == nil {
+			return "return"
+		}
+		return "return " + p.expression(stmt.Value)
+	case *ast.BreakStatement:
+		return "break"
+	case *ast.ContinueStatement:
+		return "continue"
+	case *ast.NextStatement:
+		return "next"
+	}
+	return ""
+}
+
+func (p *printer) expressionList(exprs []ast.Expression) string {
+	var out []string
+	for _, expr := range exprs {
+		out = append(out, p.expression(expr))
+	}
+	return strings.Join(out, ", ")
+}
+
+// precedence gives how tightly an expression binds, using the parser's
+// levels. Operands that bind less tightly than their operator need
+// parentheses.
+func precedence(expr ast.Expression) int {
+	switch expr := expr.(type) {
+	case *ast.AssignExpression:
+		return parser.ASSIGNMENT
+	case *ast.TernaryExpression:
+		return parser.TERNARY
+	case *ast.InfixExpression:
+		return infixPrecedence[expr.Operator]
+	case *ast.GetlineExpression:
+		return parser.PIPE
+	case *ast.PrefixExpression:
+		if expr.Operator == "++" || expr.Operator == "--" {
+			return parser.INCREMENT
+		}
+		return parser.PREFIX
+	case *ast.PostfixExpression:
+		return parser.INCREMENT
+	case *ast.FieldExpression:
+		return parser.FIELD
+	case *ast.ArrayIndexExpression:
+		if expr.ArrayName == "" && expr.Parent == nil {
+			return parser.CALL + 1 // (i, j), already in parentheses
+		}
+		return parser.INDEX
+	case *ast.CallExpression:
+		return parser.CALL
+	default:
+		return parser.CALL + 1
+	}
+}
+
+var infixPrecedence = map[string]int{
+	"||": parser.OR,
+	"&&": parser.AND,
+	"in": parser.MEMBERSHIP,
+	"~":  parser.REGEXMATCH, "!~": parser.REGEXMATCH, "~$0": parser.REGEXMATCH,
+	"==": parser.EQUALITY, "!=": parser.EQUALITY, "<": parser.EQUALITY,
+	"<=": parser.EQUALITY, ">": parser.EQUALITY, ">=": parser.EQUALITY,
+	".": parser.CONCATENATE,
+	"+": parser.SUM, "-": parser.SUM,
+	"*": parser.PRODUCT, "/": parser.PRODUCT, "%": parser.PRODUCT,
+	"^": parser.EXPONENT,
+}
+
+// operand prints an expression that must bind at least as tightly as least,
+// in parentheses if it does not.
+func (p *printer) operand(expr ast.Expression, least int) string {
+	if precedence(expr) < least {
+		return p.parenthesized(expr)
+	}
+	return p.expression(expr)
+}
+
+// rightOperand is like operand for an expression after an operator. There a
+// unary operator starts its own operand, which ends before any operator that
+// follows, so it needs no parentheses.
+func (p *printer) rightOperand(expr ast.Expression, least int) string {
+	if _, ok := expr.(*ast.PrefixExpression); ok {
+		return p.expression(expr)
+	}
+	return p.operand(expr, least)
+}
+
+func (p *printer) parenthesized(expr ast.Expression) string {
+	inPrint := p.inPrint
+	p.inPrint = false
+	defer func() { p.inPrint = inPrint }()
+	return "(" + p.expression(expr) + ")"
+}
+
+func (p *printer) expression(expr ast.Expression) string {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return expr.Value
+	case *ast.NumericLiteral:
+		if expr.Token.Type == token.NUMBER {
+			return expr.Token.Literal
+		}
+		return expr.String()
+	case *ast.StringLiteral:
+		return quote(expr.Value)
+	case *ast.RegexLiteral:
+		return "/" + expr.Value + "/"
+	case *ast.FieldExpression:
+		return "$" + p.operand(expr.Index, parser.FIELD+1)
+	case *ast.ArrayIndexExpression:
+		inPrint := p.inPrint
+		p.inPrint = false
+		defer func() { p.inPrint = inPrint }()
+		subscripts := p.expressionList(expr.IndexList)
+		switch {
+		case expr.Parent != nil:
+			return p.expression(expr.Parent) + "[" + subscripts + "]"
+		case expr.ArrayName != "":
+			return expr.ArrayName + "[" + subscripts + "]"
+		default:
+			return "(" + subscripts + ")"
+		}
+	case *ast.CallExpression:
+		inPrint := p.inPrint
+		p.inPrint = false
+		defer func() { p.inPrint = inPrint }()
+		return expr.Function.String() + "(" + p.expressionList(expr.Arguments) + ")"
+	case *ast.AssignExpression:
+		return p.operand(expr.Target, parser.INCREMENT) + " " + expr.Operator.Literal + " " + p.rightOperand(expr.Value, parser.ASSIGNMENT)
+	case *ast.TernaryExpression:
+		return p.operand(expr.Condition, parser.TERNARY+1) + " ? " + p.expression(expr.IfTrue) + " : " + p.rightOperand(expr.IfFalse, parser.TERNARY)
+	case *ast.PrefixExpression:
+		operand := p.rightOperand(expr.Right, precedence(expr)+1)
+		if operand[0] == '-' || operand[0] == '+' {
+			operand = p.parenthesized(expr.Right)
+		}
+		return expr.Operator + operand
+	case *ast.PostfixExpression:
+		return p.operand(expr.Left, parser.INCREMENT+1) + expr.Operator
+	case *ast.GetlineExpression:
+		if p.inPrint && expr.Command != nil {
+			return p.parenthesized(expr)
+		}
+		var out string
+		if expr.Command != nil {
+			out = p.operand(expr.Command, parser.PIPE) + " | "
+		}
+		out += "getline"
+		if expr.Target != nil {
+			out += " " + p.expression(expr.Target)
+		}
+		if expr.File != nil {
+			out += " < " + p.operand(expr.File, parser.CONCATENATE+1)
+		}
+		return out
+	case *ast.InfixExpression:
+		return p.infix(expr)
+	}
+	return expr.String()
+}
+
+func (p *printer) infix(expr *ast.InfixExpression) string {
+	if p.inPrint && expr.Operator == ">" {
+		return p.parenthesized(expr)
+	}
+	level := infixPrecedence[expr.Operator]
+	switch expr.Operator {
+	case "^": // right associative
+		return p.operand(expr.Left, level+1) + " ^ " + p.rightOperand(expr.Right, level)
+	case ".":
+		// only some tokens start a concatenated operand; a - or / would be
+		// read as an operator instead
+		right := p.operand(expr.Right, level+1)
+		if !concatenates(expr.Right) {
+			right = p.parenthesized(expr.Right)
+		}
+		return p.operand(expr.Left, level) + " " + right
+	case "~$0":
+		return p.expression(expr.Right)
+	default:
+		return p.operand(expr.Left, level) + " " + expr.Operator + " " + p.rightOperand(expr.Right, level+1)
+	}
+}
+
+// concatenates reports whether the printed expression begins with a token
+// that the parser takes as the start of a concatenated operand.
+func concatenates(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.InfixExpression:
+		return expr.Operator != "~$0" && concatenates(expr.Left)
+	case *ast.AssignExpression:
+		return concatenates(expr.Target)
+	case *ast.TernaryExpression:
+		return concatenates(expr.Condition)
+	case *ast.PostfixExpression:
+		return concatenates(expr.Left)
+	case *ast.GetlineExpression:
+		return expr.Command != nil && concatenates(expr.Command)
+	case *ast.PrefixExpression, *ast.RegexLiteral:
+		return false
+	default:
+		return true
+	}
+}
+
+// escapes are the characters the lexer reads after a backslash in a string.
+const escapes = "\"\\/abfnrtv"
+
+// quote prints a string as a double quoted literal that the lexer reads back
+// as the same string.
+func quote(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for idx := 0; idx < len(s); idx++ {
+		switch ch := s[idx]; ch {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			// the lexer keeps a backslash before any other character as written
+			if idx+1 == len(s) || strings.IndexByte(escapes, s[idx+1]) >= 0 {
+				out.WriteString(`\\`)
+			} else {
+				out.WriteByte('\\')
+			}
+		case '\a':
+			out.WriteString(`\a`)
+		case '\b':
+			out.WriteString(`\b`)
+		case '\f':
+			out.WriteString(`\f`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\v':
+			out.WriteString(`\v`)
+		default:
+			out.WriteByte(ch)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
@@ -0,0 +1,87 @@
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ahalbert/strawk/pkg/lexer"
+	"github.com/ahalbert/strawk/pkg/parser"
+	"github.com/ahalbert/strawk/pkg/token"
+)
+
+// comments returns the text of each comment in a program, in order.
+func comments(src string) []string {
+	l := lexer.New(src)
+	l.Trivia = true
+	var found []string
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.COMMENT {
+			found = append(found, strings.TrimSpace(tok.Literal))
+		}
+	}
+	return found
+}
+
+// tree parses a program and returns it with every operation parenthesized.
+func tree(t *testing.T, src string) string {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors) > 0 {
+		t.Fatalf("parsing:\n%s\n%q", src, p.Errors)
+	}
+	return program.String()
+}
+
+// TestRoundTrip formats every test program and checks that formatting again
+// changes nothing, that the comments survive and that the program parses to
+// the same tree.
+func TestRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("../../tests/*/*.awk")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test programs found: %v", err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			formatted, err := Source(string(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err := Source(formatted)
+			if err != nil {
+				t.Fatalf("formatted program does not parse: %v\n%s", err, formatted)
+			}
+			if again != formatted {
+				t.Errorf("formatting is not idempotent:\n%s\nthen:\n%s", formatted, again)
+			}
+			if got, want := strings.Join(comments(formatted), "\n"), strings.Join(comments(string(src)), "\n"); got != want {
+				t.Errorf("comments changed:\n%s\nwant:\n%s", got, want)
+			}
+			if got, want := tree(t, formatted), tree(t, string(src)); got != want {
+				t.Errorf("formatted program parsed as:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestSource(t *testing.T) {
+	tests := []struct{ src, want string }{
+		{"BEGIN{x=1 # one\nprint x}", "BEGIN {\n  x = 1 # one\n  print x\n}\n"},
+		{"# header\n\n\n\nBEGIN { }\n# trailing", "# header\n\nBEGIN {\n}\n# trailing\n"},
+	}
+	for _, test := range tests {
+		got, err := Source(test.src)
+		if err != nil || got != test.want {
+			t.Errorf("Source(%q) = %q, %v, want %q", test.src, got, err, test.want)
+		}
+	}
+	if _, err := Source("BEGIN { x = (1 }"); err == nil {
+		t.Error("formatting a malformed program succeeded")
+	}
+}
@@ -0,0 +1,191 @@
+package interpreter
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/ahalbert/strawk/pkg/ast"
+)
+
+// builtinFunction describes a function every program can call.
+type builtinFunction struct {
+	fn        func(*Interpreter, []ast.Expression) ast.Expression
+	min, max  int   // fewest and most arguments, max -1 for no limit
+	arrays    []int // indices of the arguments that are arrays
+	signature string
+	doc       string // what it does, for editors to show
+}
+
+// builtins are the functions every program can call. They take precedence
+// over functions the program defines with the same name.
+var builtins = map[string]builtinFunction{
+	"length": {
+		Length, 0, 1, nil,
+		"length([x])",
+		"Returns the number of characters in a string, $0 by default, or of elements in an array.",
+	},
+	"sub": {
+		Sub, 2, 3, nil,
+		"sub(regex, replacement [, target])",
+		"Replaces the first match of regex in target, $0 by default, and returns the number of replacements made. `&` in the replacement stands for the matched text.",
+	},
+	"gsub": {
+		Gsub, 2, 3, nil,
+		"gsub(regex, replacement [, target])",
+		"Replaces every match of regex in target, $0 by default, and returns the number of replacements made. `&` in the replacement stands for the matched text.",
+	},
+	"split": {
+		Split, 2, 3, []int{1},
+		"split(s, array [, separator])",
+		"Fills array with the pieces of s and returns how many there are. A separator of a single space, the default, splits on runs of blanks and newlines; any other single character is used literally, and longer separators are regexes.",
+	},
+	"toupper": {
+		ToUpper, 1, 1, nil,
+		"toupper(s)",
+		"Returns s with lowercase letters converted to uppercase.",
+	},
+	"tolower": {
+		ToLower, 1, 1, nil,
+		"tolower(s)",
+		"Returns s with uppercase letters converted to lowercase.",
+	},
+	"substr": {
+		Substr, 2, 3, nil,
+		"substr(s, m [, n])",
+		"Returns at most n characters of s starting at the 1-based position m, or the rest of s if n is omitted.",
+	},
+	"index": {
+		Index, 2, 2, nil,
+		"index(s, t)",
+		"Returns the 1-based position of t in s, or 0 if it does not occur.",
+	},
+	"match": {
+		Match, 2, 3, []int{2},
+		"match(s, regex [, array])",
+		"Returns the 1-based position of the first match of regex in s, or 0, and sets RSTART and RLENGTH. Given an array it is filled with the text of each group, along with its start and length under the keys (n, \"start\") and (n, \"length\").",
+	},
+	"sprintf": {
+		Sprintf, 1, -1, nil,
+		"sprintf(format, ...)",
+		"Formats its arguments according to a printf style format string.",
+	},
+	"sin": {
+		Sin, 1, 1, nil,
+		"sin(x)",
+		"Returns the sine of x, in radians.",
+	},
+	"cos": {
+		Cos, 1, 1, nil,
+		"cos(x)",
+		"Returns the cosine of x, in radians.",
+	},
+	"atan2": {
+		Atan2, 2, 2, nil,
+		"atan2(y, x)",
+		"Returns the arctangent of y/x in radians, between -π and π.",
+	},
+	"exp": {
+		Exp, 1, 1, nil,
+		"exp(x)",
+		"Returns e raised to the power x.",
+	},
+	"log": {
+		Log, 1, 1, nil,
+		"log(x)",
+		"Returns the natural logarithm of x.",
+	},
+	"sqrt": {
+		Sqrt, 1, 1, nil,
+		"sqrt(x)",
+		"Returns the square root of x.",
+	},
+	"int": {
+		Int, 1, 1, nil,
+		"int(x)",
+		"Returns x truncated towards zero.",
+	},
+	"rand": {
+		Rand, 0, 0, nil,
+		"rand()",
+		"Returns a random number in [0, 1).",
+	},
+	"srand": {
+		Srand, 0, 1, nil,
+		"srand([seed])",
+		"Seeds rand with seed, or with the time of day if called without one, and returns the previous seed.",
+	},
+	"gensub": {
+		Gensub, 3, 4, nil,
+		"gensub(regex, replacement, how [, target])",
+		"Returns target, $0 by default, with matches of regex replaced. how is \"g\" to replace every match, or a number n to replace only the nth. In the replacement `\\\\0` and `&` stand for the matched text and `\\\\1` to `\\\\9` for capture groups. The target is not modified.",
+	},
+	"patsplit": {
+		Patsplit, 2, 4, []int{1, 3},
+		"patsplit(s, array [, regex [, separators]])",
+		"Fills array with the parts of s that match regex, runs of non-blank characters by default, and returns how many there are. If given, separators receives the text between them.",
+	},
+	"asort": {
+		Asort, 1, 3, []int{0, 1},
+		"asort(source [, dest [, how]])",
+		"Sorts the values of source and stores them under the indices 1 to n, in place or in dest, and returns n. how names an ordering such as \"@val_str_desc\" or a comparison function.",
+	},
+	"asorti": {
+		Asorti, 1, 3, []int{0, 1},
+		"asorti(source [, dest [, how]])",
+		"Sorts the indices of source and stores them as values under the indices 1 to n, in place or in dest, and returns n.",
+	},
+	"strftime": {
+		Strftime, 0, 3, nil,
+		"strftime([format [, timestamp [, utc]]])",
+		"Formats timestamp, the current time by default, using the conversions of C's strftime. The time is local unless utc is true.",
+	},
+	"systime": {
+		Systime, 0, 0, nil,
+		"systime()",
+		"Returns the current time in seconds since the epoch.",
+	},
+	"mktime": {
+		Mktime, 1, 2, nil,
+		"mktime(spec [, utc])",
+		"Converts a \"YYYY MM DD HH MM SS\" date in local time, or UTC if utc is true, to seconds since the epoch, or returns -1 if spec is malformed.",
+	},
+	"isarray": {
+		IsArray, 1, 1, nil,
+		"isarray(x)",
+		"Reports whether x is an array.",
+	},
+	"system": {
+		System, 1, 1, nil,
+		"system(command)",
+		"Runs command through the shell after flushing pending output, and returns its exit status.",
+	},
+	"close": {
+		Close, 1, 1, nil,
+		"close(name)",
+		"Closes a file or command opened by a redirection or getline and returns its exit status.",
+	},
+	"fflush": {
+		Fflush, 0, 1, nil,
+		"fflush([name])",
+		"Flushes the named output file or command, or all of them when called without an argument.",
+	},
+}
+
+// BuiltinArity reports the fewest and most arguments the built-in function
+// name accepts, with max -1 if there is no limit, and whether it is a built-in.
+func BuiltinArity(name string) (min, max int, ok bool) {
+	b, ok := builtins[name]
+	return b.min, b.max, ok
+}
+
+// BuiltinDoc returns the signature of the built-in function name and a
+// description of what it does, and whether it is a built-in.
+func BuiltinDoc(name string) (signature, doc string, ok bool) {
+	b, ok := builtins[name]
+	return b.signature, b.doc, ok
+}
+
+// Builtins returns the names of the built-in functions in order.
+func Builtins() []string {
+	return slices.Sorted(maps.Keys(builtins))
+}
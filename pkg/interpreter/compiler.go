@@ -0,0 +1,771 @@
+package interpreter
+
+import (
+	"github.com/ahalbert/strawk/pkg/ast"
+	"github.com/ahalbert/strawk/pkg/token"
+)
+
+// opcode identifies a VM instruction. Instructions work on a stack of
+// values, and a and b are operands whose meaning depends on the opcode.
+type opcode uint8
+
+const (
+	opLine          opcode = iota // a statement on line a begins
+	opConst                       // push constants[a]
+	opPop                         // discard the top value
+	opDupN                        // push copies of the top a values
+	opLoadGlobal                  // push global a
+	opLoadLocal                   // push parameter a of the running function
+	opStoreGlobal                 // pop into global a, pushing the value back if b is set
+	opStoreLocal                  // pop into parameter a, pushing the value back if b is set
+	opLoad                        // push lvalue a, whose subscripts or field name are on the stack
+	opStore                       // pop a value into lvalue a, pushing it back if b is set
+	opIncrement                   // add b to lvalue a and push the new value
+	opPostIncrement               // add b to lvalue a and push the old value as a string
+	opFieldName                   // turn a field index into the name of its capture group, $name if constants[a] names a group
+	opJoin                        // join the top a subscripts with SUBSEP
+	opConcat
+	opAdd
+	opSubtract
+	opMultiply
+	opDivide
+	opModulo
+	opPower
+	opEqual
+	opNotEqual
+	opLess
+	opLessEqual
+	opGreater
+	opGreaterEqual
+	opMatch        // match a value against a regex: b is 0 for ~, 1 for !~ and 2 for a rule consuming input
+	opIn           // test whether a key is in an array
+	opNot          // logical not
+	opNegate       // unary minus
+	opToNumber     // unary plus
+	opToBool       // turn a value into 1 or 0
+	opJump         // continue at instruction a
+	opJumpIfFalse  // pop a value and jump to a if it is false
+	opJumpIfTrue   // pop a value and jump to a if it is true
+	opPushScope    // make the most recent match's capture groups visible
+	opPopScope     // drop the innermost capture group scope
+	opForIn        // pop an array and start iterating over its keys
+	opForInNext    // push the next key, or end the iteration and jump to a
+	opForInEnd     // end the innermost iteration early
+	opDelete       // delete lvalue a, an element or a whole array
+	opCall         // call the function of call site a with its arguments on the stack
+	opReturn       // return the top value from a function
+	opNext         // stop running rules against the current input
+	opPrint        // print the top a values, or those under a destination if constants[b] is a redirection
+	opGetline      // read a line from a file or, if b is set, a command into lvalue a or $0
+	opRuntimeError // stop with the error constants[a]
+)
+
+type instruction struct {
+	op opcode
+	a  int
+	b  int
+}
+
+// lvalueKind says what an lvalue refers to, and for variables where the
+// variable is stored.
+type lvalueKind uint8
+
+const (
+	globalVariable lvalueKind = iota
+	localVariable
+	dollarVariable // $0, $MATCHES and the other $ names, looked up through the capture group scopes
+	arrayElement
+	field
+)
+
+// lvalue is an assignable expression. Its variable part is resolved at
+// compile time; the subscripts of an element, one joined key per level, or
+// the name of a field are computed onto the stack before it is used.
+type lvalue struct {
+	kind    lvalueKind
+	scope   lvalueKind // where the variable, or an element's array, is stored
+	slot    int
+	name    string
+	levels  int      // subscript levels of an element: 2 for a[i][j]
+	path    []string // the element at each level, for error messages
+	display string
+}
+
+// operands is how many values the lvalue takes from the stack.
+func (lv *lvalue) operands() int {
+	switch lv.kind {
+	case arrayElement:
+		return lv.levels
+	case field:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// callSite describes a call. For built-ins each argument that is an lvalue
+// is passed by reference so the function can assign to it or use it as an
+// array; for user-defined functions variables are remembered so that an
+// unset one can become an array the function creates.
+type callSite struct {
+	name     string
+	function int   // index of the user-defined function, or -1 for a built-in
+	args     []int // lvalue of each argument, or -1
+	width    int   // stack slots the arguments take
+}
+
+type function struct {
+	name   string
+	params int
+	code   []instruction
+}
+
+// Bytecode is a program compiled for the VM. It holds no run state, so one
+// Bytecode can be shared by any number of interpreters.
+type Bytecode struct {
+	program       *ast.Program
+	resolution    *Resolution
+	begin         [][]instruction
+	rules         [][]instruction
+	ruleLines     []int
+	end           [][]instruction
+	functions     []*function
+	functionIndex map[string]int
+	globals       map[string]int // slot of each global variable the program uses
+	constants     []ast.Expression
+	lvalues       []lvalue
+	calls         []callSite
+}
+
+// Resolution returns where the program's variables are stored and the
+// misuse found while resolving them.
+func (b *Bytecode) Resolution() *Resolution {
+	return b.resolution
+}
+
+// subsepSlot is the global SUBSEP is stored in, which every program has as
+// subscripts are joined with it.
+const subsepSlot = 0
+
+// loop tracks the jumps out of a loop being compiled.
+type loop struct {
+	scopes    int  // capture group scopes open outside the loop
+	forIn     bool // break must end the iteration
+	breaks    []int
+	continues []int
+}
+
+type compiler struct {
+	code    *Bytecode
+	out     []instruction
+	res     *Resolution
+	fn      *ast.FunctionLiteral // the function being compiled, nil outside functions
+	scopes  int
+	loops   []*loop
+	strings map[string]int
+	numbers map[float64]int
+}
+
+// Compile resolves the variables of a program to slots and compiles it to
+// bytecode. Misuse found while resolving is left in Resolution().Errors for
+// the caller to report.
+func Compile(program *ast.Program) *Bytecode {
+	res := Resolve(program)
+	c := &compiler{
+		code: &Bytecode{
+			program:       program,
+			resolution:    res,
+			functionIndex: make(map[string]int),
+			globals:       make(map[string]int),
+			functions:     make([]*function, len(res.Functions)),
+		},
+		res:     res,
+		strings: make(map[string]int),
+		numbers: make(map[float64]int),
+	}
+	for _, name := range res.Globals {
+		c.global(name)
+	}
+
+	for name, info := range res.Functions {
+		c.code.functionIndex[name] = info.Index
+		c.code.functions[info.Index] = &function{name: name, params: len(info.Literal.Parameters)}
+	}
+	for _, info := range res.Functions {
+		c.fn = info.Literal
+		c.code.functions[info.Index].code = c.compileBlock(info.Literal.Body.Statements)
+	}
+	c.fn = nil
+
+	for _, stmt := range program.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.BeginStatement:
+			c.code.begin = append(c.code.begin, c.compileBlock(stmt.Statements))
+		case *ast.EndStatement:
+			c.code.end = append(c.code.end, c.compileBlock(stmt.Statements))
+		case *ast.FunctionLiteral:
+		default:
+			c.code.rules = append(c.code.rules, c.compileBlock([]ast.Statement{stmt}))
+			c.code.ruleLines = append(c.code.ruleLines, stmt.GetToken().LineNum)
+		}
+	}
+	return c.code
+}
+
+func (c *compiler) compileBlock(statements []ast.Statement) []instruction {
+	c.out = nil
+	for _, stmt := range statements {
+		c.statement(stmt)
+	}
+	return c.out
+}
+
+func (c *compiler) emit(op opcode, a int, b int) int {
+	c.out = append(c.out, instruction{op: op, a: a, b: b})
+	return len(c.out) - 1
+}
+
+// patch points the jumps at instructions to the next instruction emitted.
+func (c *compiler) patch(jumps ...int) {
+	for _, jump := range jumps {
+		c.out[jump].a = len(c.out)
+	}
+}
+
+func (c *compiler) constant(value ast.Expression) int {
+	switch value := value.(type) {
+	case *ast.StringLiteral:
+		if idx, ok := c.strings[value.Value]; ok {
+			return idx
+		}
+		c.strings[value.Value] = len(c.code.constants)
+	case *ast.NumericLiteral:
+		if idx, ok := c.numbers[value.Value]; ok {
+			return idx
+		}
+		c.numbers[value.Value] = len(c.code.constants)
+	}
+	c.code.constants = append(c.code.constants, value)
+	return len(c.code.constants) - 1
+}
+
+func (c *compiler) stringConstant(s string) int {
+	return c.constant(&ast.StringLiteral{Value: s})
+}
+
+func (c *compiler) runtimeError(msg string) {
+	c.emit(opRuntimeError, c.stringConstant(msg), 0)
+}
+
+func (c *compiler) global(name string) int {
+	if slot, ok := c.code.globals[name]; ok {
+		return slot
+	}
+	c.code.globals[name] = len(c.code.globals)
+	return c.code.globals[name]
+}
+
+func (c *compiler) addLvalue(lv lvalue) int {
+	c.code.lvalues = append(c.code.lvalues, lv)
+	return len(c.code.lvalues) - 1
+}
+
+// variable resolves a name to the parameter or global it refers to.
+func (c *compiler) variable(name string) lvalue {
+	if len(name) > 0 && name[0] == '$' {
+		return lvalue{kind: dollarVariable, scope: dollarVariable, name: name, display: name}
+	}
+	if v := c.res.Lookup(c.fn, name); v.Scope == ScopeParam || v.Scope == ScopeLocal {
+		return lvalue{kind: localVariable, scope: localVariable, slot: v.Slot, name: name, display: name}
+	}
+	return lvalue{kind: globalVariable, scope: globalVariable, slot: c.global(name), name: name, display: name}
+}
+
+func (c *compiler) statement(stmt ast.Statement) {
+	if stmt == nil {
+		return
+	}
+	c.emit(opLine, stmt.GetToken().LineNum, 0)
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		for _, expr := range stmt.Expressions {
+			c.effect(expr)
+		}
+	case *ast.PrintStatement:
+		c.print(stmt)
+	case *ast.AssignStatement:
+		for idx, target := range stmt.Targets {
+			c.assign(target, token.ASSIGN, stmt.Values[idx], false)
+		}
+	case *ast.ActionBlockStatement:
+		c.expression(stmt.Conditon)
+		skip := c.emit(opJumpIfFalse, 0, 0)
+		c.scopedBlock(stmt.Statements.Statements)
+		c.patch(skip)
+	case *ast.IfStatement:
+		var ends []int
+		for idx, condition := range stmt.Conditions {
+			c.expression(condition)
+			skip := c.emit(opJumpIfFalse, 0, 0)
+			c.scopedBlock(stmt.Consequences[idx].Statements)
+			ends = append(ends, c.emit(opJump, 0, 0))
+			c.patch(skip)
+		}
+		if stmt.Else != nil {
+			c.scopedBlock(stmt.Else.Statements)
+		}
+		c.patch(ends...)
+	case *ast.WhileStatement:
+		start := len(c.out)
+		c.expression(stmt.Condition)
+		exit := c.emit(opJumpIfFalse, 0, 0)
+		l := c.loopBody(stmt.Block, false)
+		c.patch(l.continues...)
+		c.emit(opJump, start, 0)
+		c.patch(append(l.breaks, exit)...)
+	case *ast.DoWhileStatement:
+		start := len(c.out)
+		l := c.loopBody(stmt.Block, false)
+		c.patch(l.continues...)
+		c.expression(stmt.Condition)
+		c.emit(opJumpIfTrue, start, 0)
+		c.patch(l.breaks...)
+	case *ast.ForStatement:
+		c.statement(stmt.Initialization)
+		start := len(c.out)
+		exit := -1
+		if stmt.Condition != nil {
+			c.expression(stmt.Condition)
+			exit = c.emit(opJumpIfFalse, 0, 0)
+		}
+		l := c.loopBody(stmt.Block, false)
+		c.patch(l.continues...)
+		c.statement(stmt.Action)
+		c.emit(opJump, start, 0)
+		if exit >= 0 {
+			c.patch(exit)
+		}
+		c.patch(l.breaks...)
+	case *ast.ForEachStatement:
+		c.expression(stmt.Array)
+		c.emit(opForIn, 0, 0)
+		next := c.emit(opForInNext, 0, 0)
+		c.store(c.variable(stmt.VarName.Value), false)
+		l := c.loopBody(stmt.Block, true)
+		c.patch(l.continues...)
+		c.emit(opJump, next, 0)
+		c.patch(next)
+		c.patch(l.breaks...)
+	case *ast.DeleteStatement:
+		switch stmt.ToDelete.(type) {
+		case *ast.Identifier, *ast.ArrayIndexExpression:
+			c.emit(opDelete, c.lvalue(stmt.ToDelete), 0)
+		}
+	case *ast.ReturnStatement:
+		if c.fn == nil {
+			c.runtimeError("return outside function body")
+			return
+		}
+		if stmt.Value != nil {
+			c.expression(stmt.Value)
+		} else {
+			c.emit(opConst, c.stringConstant(""), 0)
+		}
+		c.emit(opReturn, 0, 0)
+	case *ast.NextStatement:
+		c.emit(opNext, 0, 0)
+	case *ast.BreakStatement:
+		if len(c.loops) == 0 {
+			c.runtimeError("break outside a loop")
+			return
+		}
+		l := c.loops[len(c.loops)-1]
+		c.closeScopes(l.scopes)
+		if l.forIn {
+			c.emit(opForInEnd, 0, 0)
+		}
+		l.breaks = append(l.breaks, c.emit(opJump, 0, 0))
+	case *ast.ContinueStatement:
+		if len(c.loops) == 0 {
+			c.runtimeError("continue outside a loop")
+			return
+		}
+		l := c.loops[len(c.loops)-1]
+		c.closeScopes(l.scopes)
+		l.continues = append(l.continues, c.emit(opJump, 0, 0))
+	default:
+		c.runtimeError("Unexpected statement type")
+	}
+}
+
+// scopedBlock compiles the body of a rule or if, which sees the capture
+// groups of the most recent match.
+func (c *compiler) scopedBlock(statements []ast.Statement) {
+	c.emit(opPushScope, 0, 0)
+	c.scopes++
+	for _, stmt := range statements {
+		c.statement(stmt)
+	}
+	c.scopes--
+	c.emit(opPopScope, 0, 0)
+}
+
+func (c *compiler) loopBody(block *ast.ActionBlock, forIn bool) *loop {
+	l := &loop{scopes: c.scopes, forIn: forIn}
+	c.loops = append(c.loops, l)
+	for _, stmt := range block.Statements {
+		c.statement(stmt)
+	}
+	c.loops = c.loops[:len(c.loops)-1]
+	return l
+}
+
+// closeScopes pops the scopes opened since there were only open.
+func (c *compiler) closeScopes(open int) {
+	for range c.scopes - open {
+		c.emit(opPopScope, 0, 0)
+	}
+}
+
+func (c *compiler) print(stmt *ast.PrintStatement) {
+	for _, expr := range stmt.Expressions {
+		c.expression(expr)
+	}
+	count := len(stmt.Expressions)
+	if count == 0 {
+		c.emit(opConst, c.stringConstant("$0"), 0)
+		c.emit(opLoad, c.addLvalue(lvalue{kind: field, display: "$0"}), 0)
+		count = 1
+	}
+	redirect := -1
+	if stmt.Destination != nil {
+		c.expression(stmt.Destination)
+		redirect = c.stringConstant(stmt.Redirect.Literal)
+	}
+	c.emit(opPrint, count, redirect)
+}
+
+// effect compiles an expression whose value is not used.
+func (c *compiler) effect(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.AssignExpression:
+		c.assign(expr.Target, expr.Operator.Type, expr.Value, false)
+		return
+	case *ast.PostfixExpression:
+		// the old value is not needed, so the cheaper prefix form will do
+		switch expr.Operator {
+		case "++":
+			c.increment(opIncrement, expr.Left, 1)
+			c.emit(opPop, 0, 0)
+			return
+		case "--":
+			c.increment(opIncrement, expr.Left, -1)
+			c.emit(opPop, 0, 0)
+			return
+		}
+	}
+	c.expression(expr)
+	c.emit(opPop, 0, 0)
+}
+
+var assignmentOperators = map[token.TokenType]opcode{
+	token.ASSIGNPLUS:     opAdd,
+	token.ASSIGNMINUS:    opSubtract,
+	token.ASSIGNMULTIPLY: opMultiply,
+	token.ASSIGNDIVIDE:   opDivide,
+	token.ASSIGNMODULO:   opModulo,
+	token.ASSIGNEXPONENT: opPower,
+}
+
+var binaryOperators = map[string]opcode{
+	".":  opConcat,
+	"+":  opAdd,
+	"-":  opSubtract,
+	"*":  opMultiply,
+	"/":  opDivide,
+	"%":  opModulo,
+	"^":  opPower,
+	"==": opEqual,
+	"!=": opNotEqual,
+	"<":  opLess,
+	"<=": opLessEqual,
+	">":  opGreater,
+	">=": opGreaterEqual,
+}
+
+// assign compiles target op= value. The subscripts of an element are
+// evaluated once, before the value.
+func (c *compiler) assign(target ast.Expression, op token.TokenType, value ast.Expression, keep bool) {
+	binary, compound := assignmentOperators[op]
+	if op != token.ASSIGN && !compound {
+		c.runtimeError("Unknown Operator.")
+		return
+	}
+	if !isLvalue(target) {
+		c.runtimeError("attempt to assign to " + target.String())
+		return
+	}
+	if ident, ok := target.(*ast.Identifier); ok {
+		if lv := c.variable(ident.Value); lv.kind != dollarVariable {
+			if compound {
+				c.load(lv)
+			}
+			c.expression(value)
+			if compound {
+				c.emit(binary, 0, 0)
+			}
+			c.store(lv, keep)
+			return
+		}
+	}
+
+	lv := c.lvalue(target)
+	if compound {
+		c.emit(opDupN, c.code.lvalues[lv].operands(), 0)
+		c.emit(opLoad, lv, 0)
+	}
+	c.expression(value)
+	if compound {
+		c.emit(binary, 0, 0)
+	}
+	c.emit(opStore, lv, boolToOperand(keep))
+}
+
+func boolToOperand(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (c *compiler) load(lv lvalue) {
+	switch lv.kind {
+	case globalVariable:
+		c.emit(opLoadGlobal, lv.slot, 0)
+	case localVariable:
+		c.emit(opLoadLocal, lv.slot, 0)
+	default:
+		c.emit(opLoad, c.addLvalue(lv), 0)
+	}
+}
+
+// store compiles an assignment of the top value to a variable.
+func (c *compiler) store(lv lvalue, keep bool) {
+	switch lv.kind {
+	case globalVariable:
+		c.emit(opStoreGlobal, lv.slot, boolToOperand(keep))
+	case localVariable:
+		c.emit(opStoreLocal, lv.slot, boolToOperand(keep))
+	default:
+		c.emit(opStore, c.addLvalue(lv), boolToOperand(keep))
+	}
+}
+
+// lvalue compiles the subscripts or field name of an assignable expression
+// and returns its lvalue.
+func (c *compiler) lvalue(expr ast.Expression) int {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return c.addLvalue(c.variable(expr.Value))
+	case *ast.ArrayIndexExpression:
+		var levels []*ast.ArrayIndexExpression
+		for level := expr; level != nil; level = level.Parent {
+			levels = append([]*ast.ArrayIndexExpression{level}, levels...)
+		}
+		lv := c.variable(levels[0].ArrayName)
+		lv.kind = arrayElement
+		lv.levels = len(levels)
+		lv.display = expr.String()
+		for _, level := range levels {
+			c.subscripts(level.IndexList)
+			lv.path = append(lv.path, level.String())
+		}
+		return c.addLvalue(lv)
+	case *ast.FieldExpression:
+		c.expression(expr.Index)
+		name := -1
+		if ident, ok := expr.Index.(*ast.Identifier); ok {
+			name = c.stringConstant(ident.Value)
+		}
+		c.emit(opFieldName, name, 0)
+		return c.addLvalue(lvalue{kind: field, display: expr.String()})
+	default:
+		c.expression(expr)
+		return -1
+	}
+}
+
+func isLvalue(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.Identifier, *ast.ArrayIndexExpression, *ast.FieldExpression:
+		return true
+	}
+	return false
+}
+
+// subscripts compiles the subscripts of a[i, j] to the key they select.
+func (c *compiler) subscripts(list []ast.Expression) {
+	for _, expr := range list {
+		c.expression(expr)
+	}
+	if len(list) != 1 {
+		c.emit(opJoin, len(list), 0)
+	}
+}
+
+// expression compiles an expression that pushes its value.
+func (c *compiler) expression(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		c.load(c.variable(expr.Value))
+	case *ast.ArrayIndexExpression, *ast.FieldExpression:
+		c.emit(opLoad, c.lvalue(expr), 0)
+	case *ast.AssignExpression:
+		c.assign(expr.Target, expr.Operator.Type, expr.Value, true)
+	case *ast.TernaryExpression:
+		c.expression(expr.Condition)
+		ifFalse := c.emit(opJumpIfFalse, 0, 0)
+		c.expression(expr.IfTrue)
+		end := c.emit(opJump, 0, 0)
+		c.patch(ifFalse)
+		c.expression(expr.IfFalse)
+		c.patch(end)
+	case *ast.PrefixExpression:
+		switch expr.Operator {
+		case "++":
+			c.increment(opIncrement, expr.Right, 1)
+		case "--":
+			c.increment(opIncrement, expr.Right, -1)
+		case "!":
+			c.expression(expr.Right)
+			c.emit(opNot, 0, 0)
+		case "-":
+			c.expression(expr.Right)
+			c.emit(opNegate, 0, 0)
+		case "+":
+			c.expression(expr.Right)
+			c.emit(opToNumber, 0, 0)
+		default:
+			c.runtimeError("Unknown prefix operator")
+		}
+	case *ast.PostfixExpression:
+		switch expr.Operator {
+		case "++":
+			c.increment(opPostIncrement, expr.Left, 1)
+		case "--":
+			c.increment(opPostIncrement, expr.Left, -1)
+		default:
+			c.runtimeError("Unknown postfix operator!")
+		}
+	case *ast.InfixExpression:
+		c.infix(expr)
+	case *ast.CallExpression:
+		c.call(expr)
+	case *ast.GetlineExpression:
+		isCommand := 0
+		if expr.Command != nil {
+			c.expression(expr.Command)
+			isCommand = 1
+		} else {
+			c.expression(expr.File)
+		}
+		target := -1
+		if expr.Target != nil && isLvalue(expr.Target) {
+			target = c.lvalue(expr.Target)
+		}
+		c.emit(opGetline, target, isCommand)
+	default:
+		c.emit(opConst, c.constant(expr), 0)
+	}
+}
+
+func (c *compiler) increment(op opcode, target ast.Expression, delta int) {
+	if !isLvalue(target) {
+		c.runtimeError("attempt to assign to " + target.String())
+		return
+	}
+	c.emit(op, c.lvalue(target), delta)
+}
+
+func (c *compiler) infix(expr *ast.InfixExpression) {
+	switch expr.Operator {
+	case "in":
+		// (i, j) in arr parses as an index expression without an array name
+		if group, ok := expr.Left.(*ast.ArrayIndexExpression); ok && group.ArrayName == "" {
+			c.subscripts(group.IndexList)
+		} else {
+			c.expression(expr.Left)
+		}
+		c.expression(expr.Right)
+		c.emit(opIn, 0, 0)
+	case "&&", "||":
+		// the right hand side is only evaluated when it decides the result,
+		// so assignments there are skipped like in awk
+		c.expression(expr.Left)
+		shortCircuit := opJumpIfFalse
+		if expr.Operator == "||" {
+			shortCircuit = opJumpIfTrue
+		}
+		skip := c.emit(shortCircuit, 0, 0)
+		c.expression(expr.Right)
+		c.emit(opToBool, 0, 0)
+		end := c.emit(opJump, 0, 0)
+		c.patch(skip)
+		c.emit(opConst, c.stringConstant(boolToExpression(expr.Operator == "||").String()), 0)
+		c.patch(end)
+	case "~", "!~", "~$0":
+		c.expression(expr.Left)
+		c.expression(expr.Right)
+		c.emit(opMatch, 0, map[string]int{"~": 0, "!~": 1, "~$0": 2}[expr.Operator])
+	default:
+		op, ok := binaryOperators[expr.Operator]
+		if !ok {
+			c.runtimeError("Unknown Operator!")
+			return
+		}
+		c.expression(expr.Left)
+		c.expression(expr.Right)
+		c.emit(op, 0, 0)
+	}
+}
+
+func (c *compiler) call(expr *ast.CallExpression) {
+	site := callSite{name: expr.Function.String(), function: -1}
+	fn, isUserDefined := c.code.functionIndex[site.name]
+	if _, ok := builtins[site.name]; ok {
+		isUserDefined = false
+	}
+
+	if isUserDefined {
+		if len(expr.Arguments) > c.code.functions[fn].params {
+			c.runtimeError("incorrect number of arguments to function.")
+			return
+		}
+		site.function = fn
+		for _, arg := range expr.Arguments {
+			c.expression(arg)
+			lv := -1
+			if ident, ok := arg.(*ast.Identifier); ok {
+				if v := c.variable(ident.Value); v.kind == globalVariable {
+					lv = c.addLvalue(v)
+				}
+			}
+			site.args = append(site.args, lv)
+		}
+		site.width = len(expr.Arguments)
+	} else {
+		for _, arg := range expr.Arguments {
+			if !isLvalue(arg) {
+				c.expression(arg)
+				site.args = append(site.args, -1)
+				site.width++
+				continue
+			}
+			lv := c.lvalue(arg)
+			site.args = append(site.args, lv)
+			site.width += c.code.lvalues[lv].operands()
+		}
+	}
+	c.code.calls = append(c.code.calls, site)
+	c.emit(opCall, len(c.code.calls)-1, 0)
+}
@@ -1,120 +1,176 @@
 package interpreter
 
 import (
-	"errors"
+	"cmp"
+	"context"
 	"fmt"
 	"io"
 	"math"
+	"math/rand"
 	"regexp"
-	"sort"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/ahalbert/strawk/pkg/ast"
-	"github.com/ahalbert/strawk/pkg/token"
 )
 
+// defaultSubsep separates the subscripts of a[i, j] unless SUBSEP is changed.
+const defaultSubsep = "\x1c"
+
 type Interpreter struct {
-	BeginBlocks                  []*ast.BeginStatement
-	EndBlocks                    []*ast.EndStatement
-	Rules                        []ast.Statement
-	curStatement                 ast.Statement //For reporting line number a runtime error hits
 	Program                      *ast.Program
 	Input                        string
 	Output                       io.Writer
 	WasNextStatementHit          bool
 	WasFatalErrorHit             bool
+	Limits                       Limits
+	OnMatch                      func(MatchEvent) // called each time a rule's regex consumes input
+	Warnings                     io.Writer        // where warnings about the program are written, nil to discard them
 	InputPostion                 int
 	Stack                        []CallStackEntry
-	GlobalVariables              map[string]ast.Expression
 	StdLibFunctions              map[string]func(*Interpreter, []ast.Expression) ast.Expression
 	UserDefinedFunctions         map[string]*ast.FunctionLiteral
+	code                         *Bytecode
+	globals                      []value                   // indexed by the slots of Bytecode.globals
+	extraGlobals                 map[string]ast.Expression // globals the program does not mention, set by SetGlobal
+	constants                    []value                   // Bytecode.constants unpacked
+	stack                        []value                   // operands of the running code
+	locals                       []value                   // parameters of the running function
+	references                   map[int]int               // global each unset parameter was passed as
+	callDepth                    int
+	line                         int // for reporting the line a runtime error hits
 	mostRecentRegexCaptureGroups map[string]ast.Expression
+	mostRecentRegexMatch         *regexMatch
+	regexes                      map[string]*regexp.Regexp
+	lineScan                     lineScan
+	callArguments                []*location
+	random                       *rand.Rand
+	seed                         int64
+	outputs                      map[string]*outputStream
+	inputs                       map[string]*inputStream
+	steps                        int
+	currentRule                  int
+	warnedRules                  map[int]bool    // rules warned about matching the empty string
+	ctx                          context.Context // cancels the run
+	deadline                     context.Context // ctx limited to Limits.MaxDuration
+	err                          error
+}
+
+// lineScan caches how far the input has been scanned for newlines.
+type lineScan struct {
+	offset    int
+	line      int
+	lineStart int
 }
 
 type CallStackEntry struct {
-	isFunction     bool
 	LocalVariables map[string]ast.Expression
+	Match          *regexMatch
+}
+
+// regexMatch records where each capture group of a match lies within the
+// matched text, so that assigning to a field can splice it back into $0.
+type regexMatch struct {
+	Text  string
+	Spans []int // start and end offset of each group within Text, -1 if the group did not participate
+	Names []string
 }
 
+// NewInterpreter compiles a program and prepares to run it.
 func NewInterpreter(program *ast.Program, out io.Writer) *Interpreter {
+	return NewInterpreterFromBytecode(Compile(program), out)
+}
+
+// NewInterpreterFromBytecode prepares to run an already compiled program.
+func NewInterpreterFromBytecode(code *Bytecode, out io.Writer) *Interpreter {
 	i := &Interpreter{
-		Program:              program,
+		Program:              code.program,
 		Output:               out,
-		GlobalVariables:      make(map[string]ast.Expression),
 		StdLibFunctions:      make(map[string]func(*Interpreter, []ast.Expression) ast.Expression),
 		UserDefinedFunctions: make(map[string]*ast.FunctionLiteral),
+		code:                 code,
+		globals:              make([]value, len(code.globals)),
+		regexes:              make(map[string]*regexp.Regexp),
+		warnedRules:          make(map[int]bool),
+		outputs:              make(map[string]*outputStream),
+		inputs:               make(map[string]*inputStream),
+	}
+	i.globals[subsepSlot] = stringValue(defaultSubsep)
+	for _, constant := range code.constants {
+		i.constants = append(i.constants, fromExpression(constant))
 	}
 	i.resetStack()
 	i.InputPostion = 0
-	for _, stmt := range program.Statements {
-		switch stmt.(type) {
-		case *ast.BeginStatement:
-			i.BeginBlocks = append(i.BeginBlocks, stmt.(*ast.BeginStatement))
-		case *ast.EndStatement:
-			i.EndBlocks = append(i.EndBlocks, stmt.(*ast.EndStatement))
-		case *ast.FunctionLiteral:
-			i.UserDefinedFunctions[stmt.(*ast.FunctionLiteral).Name.Value] = stmt.(*ast.FunctionLiteral)
-		default:
-			i.Rules = append(i.Rules, stmt)
-		}
-	}
-
-	i.StdLibFunctions["length"] = Length
-	i.StdLibFunctions["sub"] = Sub
-	i.StdLibFunctions["gsub"] = Gsub
-	i.StdLibFunctions["split"] = Split
-	i.StdLibFunctions["toupper"] = ToUpper
-	i.StdLibFunctions["tolower"] = ToLower
-	i.StdLibFunctions["substr"] = Substr
-	i.StdLibFunctions["index"] = Index
-	i.StdLibFunctions["match"] = Match
+	i.lineScan = lineScan{line: 1}
+	i.SeedRandom(0)
+	for name, info := range code.resolution.Functions {
+		i.UserDefinedFunctions[name] = info.Literal
+	}
+	for name, b := range builtins {
+		i.StdLibFunctions[name] = b.fn
+	}
 	return i
 }
 
-func (i *Interpreter) Run(input string) {
+// SeedRandom seeds the generator behind rand, so that programs using it
+// produce the same output on every run.
+func (i *Interpreter) SeedRandom(seed int64) {
+	i.seed = seed
+	i.random = rand.New(rand.NewSource(seed))
+}
+
+// Run executes the program over input. A runtime error stops the run and is
+// returned as a *RuntimeError, without writing anything to the output; a
+// *LimitError is returned if the program exceeded one of its Limits.
+func (i *Interpreter) Run(input string) error {
+	return i.RunContext(context.Background(), input)
+}
+
+// RunContext is like Run but stops when ctx is done, returning a
+// *RuntimeError that wraps ctx.Err().
+func (i *Interpreter) RunContext(ctx context.Context, input string) error {
 	i.Input = input
+	defer i.startLimits(ctx)()
+	defer i.closeAllStreams()
 
-	for _, block := range i.BeginBlocks {
-		for _, stmt := range block.Statements {
-			i.topLevelWrapperdoStatement(stmt)
-			if i.WasFatalErrorHit {
-				return
-			}
+	for _, block := range i.code.begin {
+		i.runBlock(block)
+		if i.WasFatalErrorHit {
+			return i.err
 		}
 	}
 
-	i.advanceInput()
 	for i.InputPostion < len(i.Input) {
-		for _, stmt := range i.Rules {
-			i.topLevelWrapperdoStatement(stmt)
+		i.advanceInput()
+		for idx, rule := range i.code.rules {
+			i.currentRule = idx
+			i.runBlock(rule)
 			if i.WasNextStatementHit {
 				i.WasNextStatementHit = false
 				i.resetStack()
 				break
 			}
 			if i.WasFatalErrorHit {
-				return
+				return i.err
 			}
 		}
-		i.advanceInput()
 	}
 
-	for _, block := range i.EndBlocks {
-		for _, stmt := range block.Statements {
-			i.topLevelWrapperdoStatement(stmt)
-			if i.WasFatalErrorHit {
-				return
-			}
+	for _, block := range i.code.end {
+		i.runBlock(block)
+		if i.WasFatalErrorHit {
+			return i.err
 		}
 	}
+	return nil
 }
 
 func (i *Interpreter) advanceInput() {
 	if i.InputPostion >= len(i.Input) {
 		return
 	}
-	i.Stack[0].LocalVariables["$0"] = i.doConcatenate(i.Stack[0].LocalVariables["$0"], &ast.StringLiteral{Value: string(i.Input[i.InputPostion])})
+	i.Stack[0].LocalVariables["$0"] = &ast.StringLiteral{Value: i.Stack[0].LocalVariables["$0"].String() + string(i.Input[i.InputPostion])}
 	i.InputPostion += 1
 }
 
@@ -135,579 +191,390 @@ func (i *Interpreter) resetStack() {
 	i.Stack[0].LocalVariables["$0"] = &ast.StringLiteral{Value: ""}
 }
 
-func (i *Interpreter) attemptArrayLookup(indicies []ast.Expression, variable ast.Expression) ast.Expression {
-	if indicies == nil {
-		switch variable.(type) {
-		case *ast.StringLiteral:
-			return variable
-		case *ast.NumericLiteral:
-			return variable
-		case *ast.AssociativeArray:
-			return variable
-		default:
-			panic("Unknown variable type")
-		}
-	} else {
-		switch variable.(type) {
-		case *ast.StringLiteral:
-			panic("attempt to address scalar with index")
-		case *ast.NumericLiteral:
-			panic("attempt to address scalar with index")
-		case *ast.AssociativeArray:
-			val, ok := variable.(*ast.AssociativeArray).Array[i.transformArrayLookupExpression(indicies)]
-			if ok {
-				return val
-			}
-			return &ast.StringLiteral{Value: ""}
-		default:
-			panic("Unknown variable type")
-		}
+// joinSubscripts joins the subscripts of a[i, j] with SUBSEP into the key
+// the element is stored under.
+func (i *Interpreter) joinSubscripts(subscripts ...string) string {
+	subsep := i.globals[subsepSlot]
+	if subsep.isUnset() {
+		return strings.Join(subscripts, defaultSubsep)
 	}
+	return strings.Join(subscripts, subsep.String())
 }
 
-func (i *Interpreter) transformArrayLookupExpression(indicies []ast.Expression) string {
-	var idxs []string
-	for _, x := range indicies {
-		idxs = append(idxs, i.doExpression(x).String())
+// GetGlobal returns the value of a global variable, or nil if it is unset.
+func (i *Interpreter) GetGlobal(name string) ast.Expression {
+	if slot, ok := i.code.globals[name]; ok {
+		return i.globals[slot].expression()
 	}
-	return strings.Join(idxs, ",")
+	return i.extraGlobals[name]
 }
 
-func (i *Interpreter) lookupVar(varName ast.Expression) ast.Expression {
-	var id string
-	var index []ast.Expression
-	switch varName.(type) {
-	case *ast.Identifier:
-		id = varName.(*ast.Identifier).Value
-		index = nil
-	case *ast.ArrayIndexExpression:
-		id = varName.(*ast.ArrayIndexExpression).ArrayName
-		index = varName.(*ast.ArrayIndexExpression).IndexList
-	default:
-		panic("Unexpected expression type in lookupVar")
-	}
-	val, ok := i.Stack[len(i.Stack)-1].LocalVariables[id]
-	if ok {
-		return i.attemptArrayLookup(index, val)
+// SetGlobal sets a global variable.
+func (i *Interpreter) SetGlobal(name string, value ast.Expression) {
+	if slot, ok := i.code.globals[name]; ok {
+		i.globals[slot] = fromExpression(value)
+		return
 	}
-	val, ok = i.GlobalVariables[id]
-	if ok {
-		return i.attemptArrayLookup(index, val)
+	if i.extraGlobals == nil {
+		i.extraGlobals = make(map[string]ast.Expression)
 	}
-	return &ast.StringLiteral{Value: ""}
+	i.extraGlobals[name] = value
 }
 
-func (i *Interpreter) setVar(varName ast.Expression, value ast.Expression) {
-	var id string
-	var index []ast.Expression
-	switch varName.(type) {
-	case *ast.Identifier:
-		id = varName.(*ast.Identifier).Value
-		index = nil
-	case *ast.ArrayIndexExpression:
-		id = varName.(*ast.ArrayIndexExpression).ArrayName
-		index = varName.(*ast.ArrayIndexExpression).IndexList
-	default:
-		panic("Unexpected expression type in lookupVar")
-	}
-	_, ok := i.Stack[len(i.Stack)-1].LocalVariables[id]
-	if ok {
-		if index == nil {
-			i.Stack[len(i.Stack)-1].LocalVariables[id] = value
-		} else {
-		}
-	} else {
-		if index == nil {
-			i.GlobalVariables[id] = value
-		} else {
-			m, ok := i.GlobalVariables[id]
-			if ok {
-				switch m.(type) {
-				case *ast.AssociativeArray:
-					m.(*ast.AssociativeArray).Array[i.transformArrayLookupExpression(index)] = value
-				default:
-					i.GlobalVariables[id] = &ast.AssociativeArray{Array: make(map[string]ast.Expression)}
-					i.GlobalVariables[id].(*ast.AssociativeArray).Array[i.transformArrayLookupExpression(index)] = value
-				}
-			} else {
-				i.GlobalVariables[id] = &ast.AssociativeArray{Array: make(map[string]ast.Expression)}
-				i.GlobalVariables[id].(*ast.AssociativeArray).Array[i.transformArrayLookupExpression(index)] = value
-			}
+// variables returns the scope a $ name lives in: the innermost capture
+// groups that define it, or the outermost scope.
+func (i *Interpreter) variables(id string) map[string]ast.Expression {
+	for idx := len(i.Stack) - 1; idx >= 0; idx-- {
+		if _, ok := i.Stack[idx].LocalVariables[id]; ok {
+			return i.Stack[idx].LocalVariables
 		}
 	}
+	return i.Stack[0].LocalVariables
 }
 
-func (i *Interpreter) createLocalVar(varName string, value ast.Expression) {
-	i.Stack[len(i.Stack)-1].LocalVariables[varName] = value
-}
-
-func (i *Interpreter) topLevelWrapperdoStatement(stmt ast.Statement) {
-	defer func() {
-		if r := recover(); r != nil {
-		}
-	}()
-	i.doStatement(stmt)
-}
-
-func (i *Interpreter) doStatement(stmt ast.Statement) {
-	defer func() {
-		if r := recover(); r != nil {
-			msg := r.(string)
-			if msg == "rewinding" {
-				return
-			} else if msg == "next" {
-				i.WasNextStatementHit = true
-			} else {
-				i.WasNextStatementHit = false
-				i.WasFatalErrorHit = true
-				err_msg := fmt.Sprintf("Runtime Error on line %d: %s\n", i.curStatement.GetToken().LineNum, msg)
-				io.WriteString(i.Output, err_msg)
-				panic("rewinding")
-			}
+// isNamedCaptureGroup reports whether a regex match in scope has a group
+// called name, in which case $name refers to that group rather than to the
+// field numbered by the variable name.
+func (i *Interpreter) isNamedCaptureGroup(name string) bool {
+	for idx := len(i.Stack) - 1; idx >= 0; idx-- {
+		match := i.Stack[idx].Match
+		if match != nil && slices.Contains(match.Names, name) {
+			return true
 		}
-	}()
-
-	i.curStatement = stmt
-
-	switch stmt.(type) {
-	case *ast.ExpressionStatement:
-		i.doExpressionList(stmt.(*ast.ExpressionStatement).Expressions)
-	case *ast.PrintStatement:
-		i.doPrintStatement(stmt.(*ast.PrintStatement))
-	case *ast.ActionBlockStatement:
-		i.doBlock(stmt.(*ast.ActionBlockStatement))
-	case *ast.AssignStatement:
-		i.doAssignStatement(stmt.(*ast.AssignStatement))
-	case *ast.AssignAndModifyStatement:
-		i.doAssignAndModifyStatement(stmt.(*ast.AssignAndModifyStatement))
-	case *ast.IfStatement:
-		i.doIfStatement(stmt.(*ast.IfStatement))
-	case *ast.NextStatement:
-		panic("next")
-	case *ast.WhileStatement:
-		i.doWhileStatement(stmt.(*ast.WhileStatement))
-	case *ast.DoWhileStatement:
-		i.doDoWhileStatement(stmt.(*ast.DoWhileStatement))
-	case *ast.ForStatement:
-		i.doForStatement(stmt.(*ast.ForStatement))
-	case *ast.ForEachStatement:
-		i.doForEachStatement(stmt.(*ast.ForEachStatement))
-	case *ast.DeleteStatement:
-		i.doDeleteStatement(stmt.(*ast.DeleteStatement))
-	default:
-		panic("Unexpected statement type")
 	}
+	return false
 }
 
-func (i *Interpreter) doBlock(block ast.Block) {
-	shouldExecuteBlock := false
-	switch block.(type) {
-	case *ast.BeginStatement:
-		shouldExecuteBlock = true
-	case *ast.EndStatement:
-		shouldExecuteBlock = true
-	case *ast.ActionBlock:
-		shouldExecuteBlock = true
-	case *ast.ActionBlockStatement:
-		shouldExecuteBlock = i.evaluateActionBlockConditon(block.(*ast.ActionBlockStatement))
-	}
-	if shouldExecuteBlock {
-		i.Stack = append(i.Stack, CallStackEntry{LocalVariables: i.mostRecentRegexCaptureGroups})
-		for _, stmt := range block.GetStatements() {
-			i.doStatement(stmt)
+// lookupField finds the capture group in the innermost scope that defines
+// it, so fields stay visible inside nested blocks and function calls.
+func (i *Interpreter) lookupField(name string) ast.Expression {
+	for idx := len(i.Stack) - 1; idx >= 0; idx-- {
+		val, ok := i.Stack[idx].LocalVariables[name]
+		if ok {
+			return val
 		}
-		i.Stack = i.Stack[:len(i.Stack)-1]
-	}
-}
-
-func (i *Interpreter) evaluateActionBlockConditon(block *ast.ActionBlockStatement) bool {
-	evaluatedExpr := i.doExpression(block.Conditon)
-	return ExpressionToBool(evaluatedExpr)
-}
-
-func (i *Interpreter) doPrintStatement(stmt *ast.PrintStatement) {
-	toBePrinted := i.doExpressionList(stmt.Expressions)
-	var asStrings []string
-	for _, expr := range toBePrinted {
-		asStrings = append(asStrings, expr.String())
-	}
-	io.WriteString(i.Output, strings.Join(asStrings, " "))
-	io.WriteString(i.Output, "\n")
-}
-
-func (i *Interpreter) doAssignStatement(stmt *ast.AssignStatement) {
-	for idx, target := range stmt.Targets {
-		i.setVar(target, i.doExpression(stmt.Values[idx]))
-	}
-}
-
-func (i *Interpreter) doAssignAndModifyStatement(stmt *ast.AssignAndModifyStatement) {
-	var newValue ast.Expression
-	switch stmt.Operator.Type {
-	case token.ASSIGNPLUS:
-		newValue = i.doExpression(&ast.InfixExpression{Left: stmt.Target, Operator: "+", Right: stmt.Value})
-	case token.ASSIGNMINUS:
-		newValue = i.doExpression(&ast.InfixExpression{Left: stmt.Target, Operator: "-", Right: stmt.Value})
-	case token.ASSIGNMULTIPLY:
-		newValue = i.doExpression(&ast.InfixExpression{Left: stmt.Target, Operator: "*", Right: stmt.Value})
-	case token.ASSIGNDIVIDE:
-		newValue = i.doExpression(&ast.InfixExpression{Left: stmt.Target, Operator: "/", Right: stmt.Value})
-	case token.ASSIGNMODULO:
-		newValue = i.doExpression(&ast.InfixExpression{Left: stmt.Target, Operator: "%", Right: stmt.Value})
-	case token.ASSIGNEXPONENT:
-		newValue = i.doExpression(&ast.InfixExpression{Left: stmt.Target, Operator: "^", Right: stmt.Value})
-	default:
-		panic("Unknown Operator.")
 	}
-	i.setVar(stmt.Target, newValue)
+	return emptyString
 }
 
-func (i *Interpreter) doIfStatement(stmt *ast.IfStatement) {
-	shouldExecuteElse := true
-	for idx, condition := range stmt.Conditions {
-		if ExpressionToBool(i.doExpression(condition)) {
-			shouldExecuteElse = false
-			i.doBlock(stmt.Consequences[idx])
-			break
+func (i *Interpreter) setField(name string, value ast.Expression) {
+	for idx := len(i.Stack) - 1; idx >= 0; idx-- {
+		if i.Stack[idx].Match != nil {
+			i.spliceField(i.Stack[idx], name, value)
+			return
 		}
 	}
-	if shouldExecuteElse && stmt.Else != nil {
-		i.doBlock(stmt.Else)
-	}
+	i.Stack[0].LocalVariables[name] = value
 }
 
-func (i *Interpreter) doWhileStatement(stmt *ast.WhileStatement) {
-	stmt.ShouldBreak = false
-	for ExpressionToBool(i.doExpression(stmt.Condition)) && !stmt.ShouldBreak {
-		stmt.ShouldContinue = false
-		for _, st := range stmt.Block.Statements {
-			switch st.(type) {
-			case *ast.ContinueStatement:
-				stmt.ShouldContinue = true
-			case *ast.BreakStatement:
-				stmt.ShouldBreak = true
-			default:
-				i.doStatement(st)
-			}
-			if stmt.ShouldBreak {
-				break
-			}
-			if stmt.ShouldContinue {
-				break
-			}
-		}
+// spliceField replaces a capture group within the matched text and rebuilds
+// $0 and every group that overlaps it from the result.
+func (i *Interpreter) spliceField(entry CallStackEntry, name string, value ast.Expression) {
+	match := entry.Match
+	group, err := strconv.Atoi(name[1:])
+	if err != nil {
+		group = slices.Index(match.Names, name[1:])
 	}
-}
+	replacement := value.String()
 
-func (i *Interpreter) doDoWhileStatement(stmt *ast.DoWhileStatement) {
-	stmt.ShouldBreak = false
-	initRun := true
-	for initRun || (ExpressionToBool(i.doExpression(stmt.Condition)) && !stmt.ShouldBreak) {
-		initRun = false
-		stmt.ShouldContinue = false
-		for _, st := range stmt.Block.Statements {
-			switch st.(type) {
-			case *ast.ContinueStatement:
-				stmt.ShouldContinue = true
-			case *ast.BreakStatement:
-				stmt.ShouldBreak = true
-			default:
-				i.doStatement(st)
-			}
-			if stmt.ShouldBreak {
-				break
-			}
-			if stmt.ShouldContinue {
-				break
-			}
+	if group == 0 {
+		match.Text = replacement
+		for idx := range match.Spans {
+			match.Spans[idx] = -1
 		}
-	}
-}
-
-func (i *Interpreter) doForStatement(stmt *ast.ForStatement) {
-	stmt.ShouldBreak = false
-	i.doStatement(stmt.Initialization)
-	for ExpressionToBool(i.doExpression(stmt.Condition)) && !stmt.ShouldBreak {
-		stmt.ShouldContinue = false
-		for _, st := range stmt.Block.Statements {
-			switch st.(type) {
-			case *ast.ContinueStatement:
-				stmt.ShouldContinue = true
-			case *ast.BreakStatement:
-				stmt.ShouldBreak = true
-			default:
-				i.doStatement(st)
-			}
-			if stmt.ShouldBreak {
-				break
-			}
-			if stmt.ShouldContinue {
-				break
+		match.Spans[0], match.Spans[1] = 0, len(replacement)
+	} else if group > 0 && 2*group+1 < len(match.Spans) && match.Spans[2*group] >= 0 {
+		start, end := match.Spans[2*group], match.Spans[2*group+1]
+		delta := len(replacement) - (end - start)
+		match.Text = match.Text[:start] + replacement + match.Text[end:]
+		for idx, offset := range match.Spans {
+			if offset >= end {
+				match.Spans[idx] = offset + delta
+			} else if offset > start {
+				match.Spans[idx] = start + min(offset-start, len(replacement))
 			}
 		}
-		i.doStatement(stmt.Action)
+		match.Spans[2*group], match.Spans[2*group+1] = start, start+len(replacement)
+	} else {
+		entry.LocalVariables[name] = value
+		return
 	}
+
+	setCaptureGroups(entry.LocalVariables, match)
 }
 
-func (i *Interpreter) doForEachStatement(stmt *ast.ForEachStatement) {
-	val, ok := i.Stack[len(i.Stack)-1].LocalVariables[stmt.Array.Value]
+// traversalOrder returns the keys of an array in the order for-in visits
+// them: the order they were added, unless PROCINFO["sorted_in"] names a
+// predefined ordering or a comparison function.
+func (i *Interpreter) traversalOrder(array *ast.AssociativeArray) []string {
+	procinfo, ok := i.GetGlobal("PROCINFO").(*ast.AssociativeArray)
 	if !ok {
-		val, ok = i.GlobalVariables[stmt.Array.Value]
+		return array.Keys()
 	}
+	how, ok := procinfo.Array["sorted_in"]
 	if !ok {
-		panic("Attempt to foreach on non-existent array")
+		return array.Keys()
 	}
-	array, ok := val.(*ast.AssociativeArray)
-	if !ok {
-		panic("Attempt to foreach on scalar variable")
-	}
-	keys := []string{}
-	for k := range array.Array {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	for _, k := range keys {
-		i.setVar(stmt.VarName, &ast.StringLiteral{Value: k})
-		for _, st := range stmt.Block.Statements {
-			switch st.(type) {
-			case *ast.ContinueStatement:
-				stmt.ShouldContinue = true
-			case *ast.BreakStatement:
-				stmt.ShouldBreak = true
-			default:
-				i.doStatement(st)
-			}
-			if stmt.ShouldBreak {
-				break
-			}
-			if stmt.ShouldContinue {
-				break
-			}
-		}
-	}
-}
-func (i *Interpreter) doExpressionList(expressions []ast.Expression) []ast.Expression {
-	var results []ast.Expression
-	for _, expr := range expressions {
-		results = append(results, i.doExpression(expr))
-	}
-	return results
+	return i.sortKeys(array, how.String())
 }
 
-func (i *Interpreter) doExpression(expr ast.Expression) ast.Expression {
-	switch expr.(type) {
-	case *ast.TernaryExpression:
-		return i.doTernaryExpression(expr.(*ast.TernaryExpression))
-	case *ast.PrefixExpression:
-		return i.doPrefixExpression(expr.(*ast.PrefixExpression))
-	case *ast.InfixExpression:
-		return i.doInfixExpression(expr.(*ast.InfixExpression))
-	case *ast.CallExpression:
-		return i.doFunctionCall(expr.(*ast.CallExpression))
-	case *ast.PostfixExpression:
-		return i.doPostfixExpression(expr.(*ast.PostfixExpression))
-	case *ast.Identifier:
-		return i.lookupVar(expr)
-	case *ast.ArrayIndexExpression:
-		return i.lookupVar(expr)
-	}
-	return expr
-}
-
-func (i *Interpreter) doPrefixExpression(expression *ast.PrefixExpression) ast.Expression {
-
-	switch expression.Operator {
-	case "!":
-		return invertBool(i.doExpression(expression.Right))
-	case "-":
-		return negate(i.doExpression(expression.Right))
-	case "++":
-		i.setVar(expression.Right, i.doExpression(&ast.InfixExpression{Left: expression.Right, Operator: "+", Right: &ast.NumericLiteral{Value: 1}}))
-		return i.lookupVar(expression.Right)
-	case "--":
-		i.setVar(expression.Right, i.doExpression(&ast.InfixExpression{Left: expression.Right, Operator: "-", Right: &ast.NumericLiteral{Value: 1}}))
-		return i.lookupVar(expression.Right)
-	default:
-		panic("Unknown prefix operator")
-	}
-}
-
-func (i *Interpreter) doInfixExpression(expression *ast.InfixExpression) ast.Expression {
-	left := i.doExpression(expression.Left)
-	right := i.doExpression(expression.Right)
-	switch expression.Operator {
-	case ".":
-		return i.doConcatenate(left, right)
-	case "~":
-		return i.doRegexMatch(left, right, false)
-	case "!~":
-		return invertBool(i.doRegexMatch(left, right, false))
-	case "~$0":
-		return i.doRegexMatch(left, right, true)
-	case "+":
-		return i.doAdd(left, right)
-	case "-":
-		return i.doMinus(left, right)
-	case "*":
-		return i.doMultiply(left, right)
-	case "/":
-		return i.doDivide(left, right)
-	case "%":
-		return i.doModulus(left, right)
-	case "^":
-		return i.doExponentiation(left, right)
-	case "==":
-		return i.doEquality(left, right)
-	case "!=":
-		return invertBool(i.doEquality(left, right))
-	case "<":
-		return i.doLessThan(left, right)
-	case ">":
-		return i.doGreaterThan(left, right)
-	case "<=":
-		return i.doLessThanEqualTo(left, right)
-	case ">=":
-		return i.doGreaterThanEqualTo(left, right)
-	case "in":
-		return i.doArrayMembership(left, right)
-	case "&&":
-		return i.doBooleanAnd(left, right)
-	case "||":
-		return i.doBooleanOr(left, right)
-	default:
-		panic("Unknown Operator!")
+// sortKeys orders the keys of an array as described by how, which is one of
+// gawk's "@ind_str_asc" style orderings or the name of a function called
+// with two indices and their values that returns a negative number, zero or
+// a positive number.
+func (i *Interpreter) sortKeys(array *ast.AssociativeArray, how string) []string {
+	keys := array.Keys()
+	if how == "" || how == "@unsorted" {
+		return keys
 	}
-}
 
-func (i *Interpreter) doPostfixExpression(expr *ast.PostfixExpression) ast.Expression {
-	variable := i.lookupVar(expr.Left)
-	value := &ast.StringLiteral{}
-	switch variable.(type) {
-	case *ast.ArrayIndexExpression:
-		panic("attempt to postfix array")
-	default:
-		value.Value = variable.String()
-	}
-	switch expr.Operator {
-	case "++":
-		i.setVar(expr.Left, i.doExpression(&ast.InfixExpression{Left: expr.Left, Operator: "+", Right: &ast.NumericLiteral{Value: 1}}))
-		return value
-	case "--":
-		i.setVar(expr.Left, i.doExpression(&ast.InfixExpression{Left: expr.Left, Operator: "-", Right: &ast.NumericLiteral{Value: 1}}))
-		return value
+	var compare func(a, b string) int
+	byIndex := func(a, b string) int { return strings.Compare(a, b) }
+	switch strings.TrimSuffix(strings.TrimSuffix(how, "_asc"), "_desc") {
+	case "@ind_str":
+		compare = byIndex
+	case "@ind_num":
+		compare = func(a, b string) int {
+			return cmp.Or(cmp.Compare(StringToNumber(a), StringToNumber(b)), byIndex(a, b))
+		}
+	case "@val_type":
+		compare = func(a, b string) int {
+			return cmp.Or(compareValues(array.Array[a], array.Array[b]), byIndex(a, b))
+		}
+	case "@val_str":
+		compare = func(a, b string) int {
+			return cmp.Or(strings.Compare(array.Array[a].String(), array.Array[b].String()), byIndex(a, b))
+		}
+	case "@val_num":
+		compare = func(a, b string) int {
+			av, bv := convertLiteralForMathOp(array.Array[a]), convertLiteralForMathOp(array.Array[b])
+			return cmp.Or(cmp.Compare(av, bv), byIndex(a, b))
+		}
 	default:
-		panic("Unknown postfix operator!")
+		fn, ok := i.code.functionIndex[how]
+		if !ok {
+			panic("unknown array ordering " + how)
+		}
+		compare = func(a, b string) int {
+			args := []value{literalValue(a), fromExpression(array.Array[a]), literalValue(b), fromExpression(array.Array[b])}
+			return int(i.callFunction(i.code.functions[fn], args, nil).number())
+		}
+	}
+	if strings.HasSuffix(how, "_desc") {
+		ascending := compare
+		compare = func(a, b string) int { return ascending(b, a) }
 	}
+	slices.SortStableFunc(keys, compare)
+	return keys
 }
 
-func (i *Interpreter) doRegexMatch(left ast.Expression, right ast.Expression, isReadingFromInput bool) ast.Expression {
+func (i *Interpreter) doRegexMatch(left value, right value, isReadingFromInput bool) value {
 	i.mostRecentRegexCaptureGroups = make(map[string]ast.Expression)
+	i.mostRecentRegexMatch = nil
 	var str string
 	var regex string
-	if isReadingFromInput && len(i.Stack) == 1 {
+	if isReadingFromInput && len(i.Stack) == 1 && i.callDepth == 0 {
 		isReadingFromInput = true
 	} else {
 		isReadingFromInput = false
 	}
 
-	switch left.(type) {
-	case *ast.Identifier:
-		lookup := i.lookupVar(left)
-		switch lookup.(type) {
-		case *ast.ArrayIndexExpression:
-			panic("attempt to postfix array")
-		default:
-			str = lookup.String()
-		}
-	case *ast.StringLiteral:
-		str = (left.(*ast.StringLiteral).Value)
-	default:
+	if left.kind == otherKind {
 		panic("non-string match against regex")
 	}
+	str = left.String()
 
-	switch right.(type) {
+	switch right := right.expr.(type) {
 	case *ast.RegexLiteral:
-		regex = right.(*ast.RegexLiteral).Value
+		regex = right.Value
 	default:
 		panic("non-regex match against string")
 	}
 
-	re, err := regexp.Compile(regex)
-	if err != nil {
-		panic("invalid regex")
+	re, ok := i.regexes[regex]
+	if !ok {
+		var err error
+		re, err = regexp.Compile(regex)
+		if err != nil {
+			panic("invalid regex")
+		}
+		i.regexes[regex] = re
 	}
 
-	matches := re.FindStringSubmatch(str)
-	if matches != nil {
+	var loc []int
+	if isReadingFromInput {
+		loc = i.ruleMatch(re, str)
+	} else {
+		loc = re.FindStringSubmatchIndex(str)
+	}
+	if loc != nil {
 		if isReadingFromInput {
-			prevMatches := matches
-			prevMatch := &matches[0]
-			i.advanceInput()
-			newMatches := re.FindStringSubmatch(i.Stack[0].LocalVariables["$0"].(*ast.StringLiteral).Value)
-			newMatch := &newMatches[0]
-			for *prevMatch != *newMatch {
+			// extend the match over the input for as long as it keeps growing
+			match := str[loc[0]:loc[1]]
+			for i.InputPostion < len(i.Input) {
 				i.advanceInput()
-				prevMatches = newMatches
-				prevMatch = newMatch
-				newMatches = re.FindStringSubmatch(i.Stack[0].LocalVariables["$0"].(*ast.StringLiteral).Value)
-				newMatch = &newMatches[0]
+				buffer := i.Stack[0].LocalVariables["$0"].(*ast.StringLiteral).Value
+				next := i.ruleMatch(re, buffer)
+				if next == nil || buffer[next[0]:next[1]] == match {
+					i.backtrackInput()
+					break
+				}
+				str, loc, match = buffer, next, buffer[next[0]:next[1]]
 			}
-
-			i.backtrackInput()
 			i.consumeInput()
-			matches = prevMatches
 		}
-		i.mostRecentRegexCaptureGroups["$MATCHES"] = &ast.AssociativeArray{Array: make(map[string]ast.Expression)}
-		matchesArray, _ := i.mostRecentRegexCaptureGroups["$MATCHES"].(*ast.AssociativeArray)
-		for idx, match := range matches {
-			stridx := "$" + strconv.Itoa(idx)
-			i.mostRecentRegexCaptureGroups[stridx] = ast.NewLiteral(match)
-			matchesArray.Array[stridx] = ast.NewLiteral(match)
+		i.mostRecentRegexMatch = newRegexMatch(str, loc, re.SubexpNames())
+		setCaptureGroups(i.mostRecentRegexCaptureGroups, i.mostRecentRegexMatch)
+		if isReadingFromInput {
+			i.setInputPosition(i.mostRecentRegexCaptureGroups, i.InputPostion-len(str)+loc[0])
+			if i.OnMatch != nil {
+				i.OnMatch(i.matchEvent(i.InputPostion-len(str)+loc[0], i.mostRecentRegexMatch))
+			}
 		}
-		return boolToExpression(true)
+		return trueValue
 	}
-	return boolToExpression(false)
+	return falseValue
 }
 
-func (i *Interpreter) doFunctionCall(call *ast.CallExpression) ast.Expression {
-	evaluatedArgs := i.doExpressionList(call.Arguments)
-	function, ok := i.StdLibFunctions[call.Function.String()]
-	if ok {
-		return function(i, evaluatedArgs)
+// ruleMatch finds the first match of a rule's regex that is not empty. A rule
+// consumes the input it matches, so an empty match would let it fire without
+// making progress; the first time a rule matches only the empty string, a
+// warning naming it is written to Warnings.
+func (i *Interpreter) ruleMatch(re *regexp.Regexp, str string) []int {
+	loc := re.FindStringSubmatchIndex(str)
+	if loc == nil || loc[1] > loc[0] {
+		return loc
 	}
-	udf, ok := i.UserDefinedFunctions[call.Function.String()]
-	if !ok {
-		panic("attempt to call non-existent function")
+	for _, loc := range re.FindAllStringSubmatchIndex(str, -1) {
+		if loc[1] > loc[0] {
+			return loc
+		}
+	}
+	if !i.warnedRules[i.currentRule] {
+		i.warnedRules[i.currentRule] = true
+		if i.Warnings != nil {
+			fmt.Fprintf(i.Warnings, "Warning: the regex /%s/ of the rule on line %d matched the empty string, which rules skip\n", re.String(), i.code.ruleLines[i.currentRule])
+		}
 	}
+	return nil
+}
 
-	if len(udf.Parameters) != len(call.Arguments) {
-		panic("incorrect number of arguments to function.")
+// newRegexMatch makes the offsets from FindStringSubmatchIndex relative to the
+// start of the match itself.
+func newRegexMatch(str string, loc []int, names []string) *regexMatch {
+	match := &regexMatch{Text: str[loc[0]:loc[1]], Spans: make([]int, len(loc)), Names: names}
+	for idx, offset := range loc {
+		if offset < 0 {
+			match.Spans[idx] = -1
+		} else {
+			match.Spans[idx] = offset - loc[0]
+		}
 	}
-	i.Stack = append(i.Stack, CallStackEntry{isFunction: true, LocalVariables: make(map[string]ast.Expression)})
-	for idx, param := range udf.Parameters {
-		_, ok = i.GlobalVariables[param.Value]
-		if !ok {
-			i.createLocalVar(param.Value, call.Arguments[idx])
+	return match
+}
+
+// setCaptureGroups stores every group of match in vars as $0, $1, ... and as
+// $name for named groups. $MATCHES holds the same values, keyed by "$0", "$1",
+// ... and by name, while $RSTART and $RLENGTH give the 1-based offset and
+// length of each group within $0, or 0 and -1 if the group did not match.
+func setCaptureGroups(vars map[string]ast.Expression, match *regexMatch) {
+	matchesArray := ast.NewAssociativeArray()
+	startsArray := ast.NewAssociativeArray()
+	lengthsArray := ast.NewAssociativeArray()
+	for idx := 0; idx < len(match.Spans)/2; idx++ {
+		start, end := match.Spans[2*idx], match.Spans[2*idx+1]
+		var value ast.Expression
+		var rstart, rlength float64
+		if start < 0 {
+			value, rstart, rlength = &ast.StringLiteral{Value: ""}, 0, -1
+		} else {
+			value, rstart, rlength = ast.NewLiteral(match.Text[start:end]), float64(start+1), float64(end-start)
+		}
+		keys := []string{"$" + strconv.Itoa(idx)}
+		if idx < len(match.Names) && match.Names[idx] != "" {
+			vars["$"+match.Names[idx]] = value
+			keys = append(keys, match.Names[idx])
+		}
+		vars[keys[0]] = value
+		for _, key := range keys {
+			matchesArray.Set(key, value)
+			startsArray.Set(key, &ast.NumericLiteral{Value: rstart})
+			lengthsArray.Set(key, &ast.NumericLiteral{Value: rlength})
+		}
+	}
+	vars["$MATCHES"] = matchesArray
+	vars["$RSTART"] = startsArray
+	vars["$RLENGTH"] = lengthsArray
+}
+
+// setInputPosition records where a rule's match starts in the input: $OFFSET
+// is the 0-based byte offset, and $LINE and $COLUMN are 1-based.
+func (i *Interpreter) setInputPosition(vars map[string]ast.Expression, offset int) {
+	line, column := i.lineAndColumn(offset)
+	vars["$OFFSET"] = &ast.NumericLiteral{Value: float64(offset)}
+	vars["$LINE"] = &ast.NumericLiteral{Value: float64(line)}
+	vars["$COLUMN"] = &ast.NumericLiteral{Value: float64(column)}
+}
+
+// MatchEvent describes a rule whose regex matched, and consumed, the input.
+type MatchEvent struct {
+	Rule       int // index of the rule among the program's pattern-action rules
+	RuleLine   int // line of the rule in the program source
+	Text       string
+	Groups     []string // capture groups, Groups[0] being the whole match; "" if a group did not participate
+	Names      []string // name of each capture group, "" if unnamed
+	Start, End int      // byte offsets of the match in the input
+	Spans      []int    // start and end offset of each group in the input, -1 if the group did not participate
+}
+
+func (i *Interpreter) matchEvent(start int, match *regexMatch) MatchEvent {
+	event := MatchEvent{
+		Rule:     i.currentRule,
+		RuleLine: i.code.ruleLines[i.currentRule],
+		Text:     match.Text,
+		Names:    match.Names,
+		Start:    start,
+		End:      start + len(match.Text),
+		Spans:    make([]int, len(match.Spans)),
+	}
+	for idx, offset := range match.Spans {
+		if offset < 0 {
+			event.Spans[idx] = -1
+		} else {
+			event.Spans[idx] = start + offset
+		}
+	}
+	for idx := 0; idx < len(match.Spans)/2; idx++ {
+		if match.Spans[2*idx] < 0 {
+			event.Groups = append(event.Groups, "")
+		} else {
+			event.Groups = append(event.Groups, match.Text[match.Spans[2*idx]:match.Spans[2*idx+1]])
 		}
 	}
+	return event
+}
 
-	for _, stmt := range udf.Body.Statements {
-		switch stmt.(type) {
-		case *ast.ReturnStatement:
-			i.Stack = i.Stack[:len(i.Stack)-1]
-			return i.doExpression(stmt.(*ast.ReturnStatement).Value)
-		default:
-			i.doStatement(stmt)
+// lineAndColumn converts a byte offset in the input to a line and column.
+// Rule matches move forward through the input, so the scan resumes from the
+// previous offset rather than counting newlines from the beginning each time.
+func (i *Interpreter) lineAndColumn(offset int) (int, int) {
+	if offset < i.lineScan.offset {
+		i.lineScan = lineScan{line: 1, lineStart: 0}
+	}
+	for idx := i.lineScan.offset; idx < offset && idx < len(i.Input); idx++ {
+		if i.Input[idx] == '\n' {
+			i.lineScan.line++
+			i.lineScan.lineStart = idx + 1
 		}
 	}
-	i.Stack = i.Stack[:len(i.Stack)-1]
-	return &ast.StringLiteral{Value: ""}
+	i.lineScan.offset = offset
+	return i.lineScan.line, offset - i.lineScan.lineStart + 1
 }
 
 func convertLiteralForMathOp(expr ast.Expression) float64 {
 	switch expr.(type) {
 	case *ast.StringLiteral:
-		return 0.0
+		return StringToNumber(expr.(*ast.StringLiteral).Value)
 	case *ast.NumericLiteral:
 		return (expr.(*ast.NumericLiteral).Value)
 	default:
@@ -715,155 +582,157 @@ func convertLiteralForMathOp(expr ast.Expression) float64 {
 	}
 }
 
-func (i *Interpreter) doAdd(left ast.Expression, right ast.Expression) ast.Expression {
-	return &ast.NumericLiteral{Value: convertLiteralForMathOp(left) + convertLiteralForMathOp(right)}
+func (i *Interpreter) doAdd(left value, right value) value {
+	return numberValue(left.number() + right.number())
 }
 
-func (i *Interpreter) doMinus(left ast.Expression, right ast.Expression) ast.Expression {
-	return &ast.NumericLiteral{Value: convertLiteralForMathOp(left) - convertLiteralForMathOp(right)}
+func (i *Interpreter) doMinus(left value, right value) value {
+	return numberValue(left.number() - right.number())
 }
 
-func (i *Interpreter) doMultiply(left ast.Expression, right ast.Expression) ast.Expression {
-	return &ast.NumericLiteral{Value: convertLiteralForMathOp(left) * convertLiteralForMathOp(right)}
+func (i *Interpreter) doMultiply(left value, right value) value {
+	return numberValue(left.number() * right.number())
 }
 
-func (i *Interpreter) doDivide(left ast.Expression, right ast.Expression) ast.Expression {
-	return &ast.NumericLiteral{Value: convertLiteralForMathOp(left) / convertLiteralForMathOp(right)}
+func (i *Interpreter) doDivide(left value, right value) value {
+	return numberValue(left.number() / right.number())
 }
 
-func (i *Interpreter) doModulus(left ast.Expression, right ast.Expression) ast.Expression {
-	return &ast.NumericLiteral{Value: math.Mod(convertLiteralForMathOp(left), convertLiteralForMathOp(right))}
+func (i *Interpreter) doModulus(left value, right value) value {
+	return numberValue(modulo(left.number(), right.number()))
 }
 
-func (i *Interpreter) doExponentiation(left ast.Expression, right ast.Expression) ast.Expression {
-	return &ast.NumericLiteral{Value: math.Pow(convertLiteralForMathOp(left), convertLiteralForMathOp(right))}
+// modulo is math.Mod, computed with integers when both operands are small
+// whole numbers, as they usually are, since math.Mod is slow.
+func modulo(x, y float64) float64 {
+	const limit = 1 << 53
+	if x == math.Trunc(x) && y == math.Trunc(y) && y != 0 && math.Abs(x) < limit && math.Abs(y) < limit {
+		return math.Copysign(float64(int64(x)%int64(y)), x)
+	}
+	return math.Mod(x, y)
 }
 
-func convertLiteralForStringOp(expr ast.Expression) string {
-	switch expr.(type) {
-	case *ast.StringLiteral:
-		return expr.(*ast.StringLiteral).Value
-	case *ast.NumericLiteral:
-		return (expr.(*ast.NumericLiteral).String())
-	default:
-		panic("error in literal to string conversion")
+func (i *Interpreter) doExponentiation(left value, right value) value {
+	return numberValue(math.Pow(left.number(), right.number()))
+}
+
+// StringToNumber converts a string the way awk does: leading blanks are
+// skipped and the longest numeric prefix is used, so "3abc" is 3 and "abc" is 0.
+func StringToNumber(s string) float64 {
+	s = strings.TrimLeft(s, " \t\n\r")
+	end := 0
+	if end < len(s) && (s[end] == '+' || s[end] == '-') {
+		end++
+	}
+	sawDigit := false
+	for end < len(s) && '0' <= s[end] && s[end] <= '9' {
+		end++
+		sawDigit = true
+	}
+	if end < len(s) && s[end] == '.' {
+		end++
+		for end < len(s) && '0' <= s[end] && s[end] <= '9' {
+			end++
+			sawDigit = true
+		}
 	}
+	if !sawDigit {
+		return 0.0
+	}
+	if end < len(s) && (s[end] == 'e' || s[end] == 'E') {
+		exp := end + 1
+		if exp < len(s) && (s[exp] == '+' || s[exp] == '-') {
+			exp++
+		}
+		if exp < len(s) && '0' <= s[exp] && s[exp] <= '9' {
+			for exp < len(s) && '0' <= s[exp] && s[exp] <= '9' {
+				exp++
+			}
+			end = exp
+		}
+	}
+	val, err := strconv.ParseFloat(s[:end], 64)
+	if err != nil {
+		return 0.0
+	}
+	return val
 }
 
-func (i *Interpreter) doConcatenate(left ast.Expression, right ast.Expression) ast.Expression {
-	lhs := convertLiteralForStringOp(left)
-	rhs := convertLiteralForStringOp(right)
-	return &ast.StringLiteral{Value: lhs + rhs}
+func (i *Interpreter) doConcatenate(left value, right value) value {
+	return stringValue(left.text() + right.text())
 }
 
 func boolToExpression(b bool) ast.Expression {
 	if b {
 		return &ast.StringLiteral{Value: "1"}
-	} else {
-		return &ast.StringLiteral{Value: "0"}
 	}
+	return &ast.StringLiteral{Value: "0"}
 }
 
-func invertBool(expr ast.Expression) ast.Expression {
-	switch expr.(type) {
-	case *ast.StringLiteral:
-		if expr.(*ast.StringLiteral).Value == "0" {
-			return &ast.StringLiteral{Value: "1"}
-		}
-		return &ast.StringLiteral{Value: "0"}
-	case *ast.NumericLiteral:
-		if expr.(*ast.NumericLiteral).Value == 0.0 {
-			return &ast.NumericLiteral{Value: 1.0}
+func boolValue(b bool) value {
+	if b {
+		return trueValue
+	}
+	return falseValue
+}
+
+func invertBool(v value) value {
+	switch v.kind {
+	case numberKind:
+		if v.num == 0.0 {
+			return numberValue(1.0)
 		}
-		return &ast.NumericLiteral{Value: 0.0}
-	default:
+		return numberValue(0.0)
+	case otherKind:
 		panic("error inverting expression!")
+	default:
+		return boolValue(!v.bool())
 	}
 }
 
-func negate(expr ast.Expression) ast.Expression {
-	switch expr.(type) {
-	case *ast.StringLiteral:
-		return &ast.NumericLiteral{Value: 0.0}
-	case *ast.NumericLiteral:
-		return &ast.NumericLiteral{Value: expr.(*ast.NumericLiteral).Value * -1.0}
-	default:
+func negate(v value) value {
+	if v.kind == otherKind {
 		panic("error inverting expression!")
 	}
+	return numberValue(-v.number())
 }
 
-func (i *Interpreter) doEquality(left ast.Expression, right ast.Expression) ast.Expression {
-	lhs := convertLiteralForStringOp(left)
-	rhs := convertLiteralForStringOp(right)
-	return boolToExpression(lhs == rhs)
+func (i *Interpreter) doEquality(left value, right value) value {
+	return boolValue(left.text() == right.text())
 }
 
-func convertLiteralForComparisonOp(expr ast.Expression) (float64, error) {
-	switch expr.(type) {
-	case *ast.StringLiteral:
-		return 0.0, errors.New("failed to convert to float")
-	case *ast.NumericLiteral:
-		return (expr.(*ast.NumericLiteral).Value), nil
-	default:
-		panic("error in math")
+// compare orders two values as numbers if both are numbers, and as strings
+// otherwise.
+func compare(left value, right value) int {
+	if left.kind == numberKind && right.kind == numberKind {
+		return cmp.Compare(left.num, right.num)
 	}
+	return strings.Compare(left.text(), right.text())
 }
 
-func (i *Interpreter) doGreaterThan(left ast.Expression, right ast.Expression) ast.Expression {
-	lhs_float, lerr := convertLiteralForComparisonOp(left)
-	rhs_float, rerr := convertLiteralForComparisonOp(right)
-	if lerr == nil && rerr == nil {
-		return boolToExpression(lhs_float > rhs_float)
-	}
-
-	lhs_str := convertLiteralForStringOp(left)
-	rhs_str := convertLiteralForStringOp(right)
-	return boolToExpression(lhs_str > rhs_str)
+func (i *Interpreter) doGreaterThan(left value, right value) value {
+	return boolValue(compare(left, right) > 0)
 }
 
-func (i *Interpreter) doGreaterThanEqualTo(left ast.Expression, right ast.Expression) ast.Expression {
-	lhs_float, lerr := convertLiteralForComparisonOp(left)
-	rhs_float, rerr := convertLiteralForComparisonOp(right)
-	if lerr == nil && rerr == nil {
-		return boolToExpression(lhs_float >= rhs_float)
-	}
-
-	lhs_str := convertLiteralForStringOp(left)
-	rhs_str := convertLiteralForStringOp(right)
-	return boolToExpression(lhs_str >= rhs_str)
+func (i *Interpreter) doGreaterThanEqualTo(left value, right value) value {
+	return boolValue(compare(left, right) >= 0)
 }
 
-func (i *Interpreter) doLessThan(left ast.Expression, right ast.Expression) ast.Expression {
-	lhs_float, lerr := convertLiteralForComparisonOp(left)
-	rhs_float, rerr := convertLiteralForComparisonOp(right)
-	if lerr == nil && rerr == nil {
-		return boolToExpression(lhs_float < rhs_float)
-	}
-
-	lhs_str := convertLiteralForStringOp(left)
-	rhs_str := convertLiteralForStringOp(right)
-	return boolToExpression(lhs_str < rhs_str)
+func (i *Interpreter) doLessThan(left value, right value) value {
+	return boolValue(compare(left, right) < 0)
 }
 
-func (i *Interpreter) doLessThanEqualTo(left ast.Expression, right ast.Expression) ast.Expression {
-	lhs_float, lerr := convertLiteralForComparisonOp(left)
-	rhs_float, rerr := convertLiteralForComparisonOp(right)
-	if lerr == nil && rerr == nil {
-		return boolToExpression(lhs_float <= rhs_float)
-	}
-
-	lhs_str := convertLiteralForStringOp(left)
-	rhs_str := convertLiteralForStringOp(right)
-	return boolToExpression(lhs_str <= rhs_str)
+func (i *Interpreter) doLessThanEqualTo(left value, right value) value {
+	return boolValue(compare(left, right) <= 0)
 }
 
+// ExpressionToBool returns an expression as a condition: false for the number
+// 0, the string "0" and the empty string, true otherwise.
 func ExpressionToBool(expr ast.Expression) bool {
 	switch expr.(type) {
 	case *ast.StringLiteral:
-		if expr.(*ast.StringLiteral).String() == "0" {
-			return false
-		}
-		return true
+		value := expr.(*ast.StringLiteral).Value
+		return value != "" && value != "0"
 	case *ast.NumericLiteral:
 		if (expr.(*ast.NumericLiteral).Value) == 0.0 {
 			return false
@@ -876,67 +745,11 @@ func ExpressionToBool(expr ast.Expression) bool {
 	}
 }
 
-func (i *Interpreter) doTernaryExpression(expr *ast.TernaryExpression) ast.Expression {
-	if ExpressionToBool(i.doExpression(expr.Condition)) {
-		return i.doExpression(expr.IfTrue)
-	}
-	return i.doExpression(expr.IfFalse)
-}
-
-func isKeyInExpression(key string, expr ast.Expression) bool {
-	switch expr.(type) {
-	case *ast.AssociativeArray:
-		_, ok := expr.(*ast.AssociativeArray).Array[key]
-		return ok
-	default:
-		panic("attempt to test membership of non-array")
-	}
-}
-
-func (i *Interpreter) doArrayMembership(left ast.Expression, right ast.Expression) ast.Expression {
-	var key string
-	switch left.(type) {
-	case *ast.ArrayIndexExpression:
-		key = i.transformArrayLookupExpression(left.(*ast.ArrayIndexExpression).IndexList)
-	default:
-		key = i.doExpression(left).String()
-	}
-	var m map[string]ast.Expression
-	switch right.(type) {
-	case *ast.AssociativeArray:
-		m = right.(*ast.AssociativeArray).Array
-	default:
-		return boolToExpression(false)
-	}
-	_, ok := m[key]
-	return boolToExpression(ok)
-}
-
-func (i *Interpreter) doBooleanAnd(left ast.Expression, right ast.Expression) ast.Expression {
-	l := ExpressionToBool(left)
-	r := ExpressionToBool(right)
-	result := l && r
-	return boolToExpression(result)
-}
-
-func (i *Interpreter) doBooleanOr(left ast.Expression, right ast.Expression) ast.Expression {
-	l := ExpressionToBool(left)
-	r := ExpressionToBool(right)
-	result := l || r
-	return boolToExpression(result)
-}
-
-func (i *Interpreter) doDeleteStatement(stmt *ast.DeleteStatement) {
-	val, ok := i.Stack[len(i.Stack)-1].LocalVariables[stmt.ToDelete.ArrayName]
-	if !ok {
-		val, ok = i.GlobalVariables[stmt.ToDelete.ArrayName]
-	}
-	if !ok {
-		panic("Attempt to delete on non-existent variable")
-	}
-	array, ok := val.(*ast.AssociativeArray)
-	if !ok {
-		panic("Attempt to delete on scalar variable")
+func (i *Interpreter) doArrayMembership(left value, right value) value {
+	array := right.array()
+	if array == nil {
+		return falseValue
 	}
-	delete(array.Array, i.transformArrayLookupExpression(stmt.ToDelete.IndexList))
+	_, ok := array.Array[left.String()]
+	return boolValue(ok)
 }
@@ -0,0 +1,261 @@
+package interpreter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ahalbert/strawk/pkg/ast"
+)
+
+// outputStream is a file or command that print has been redirected to. It
+// stays open until close() is called or the program ends.
+type outputStream struct {
+	writer *bufio.Writer
+	closer io.Closer
+	cmd    *exec.Cmd
+}
+
+// inputStream is a file or command that getline reads from.
+type inputStream struct {
+	reader *bufio.Reader
+	closer io.Closer
+	cmd    *exec.Cmd
+	stop   func() bool // stops the reader being closed when the run is cancelled
+}
+
+func (i *Interpreter) checkSandbox(feature string) {
+	if i.Limits.DisableIO {
+		panic(feature + " is disabled in sandbox mode")
+	}
+}
+
+// commandWaitDelay is how long waiting for a command killed because the run
+// was cancelled or timed out may take, as commands it started can hold its output open.
+const commandWaitDelay = 100 * time.Millisecond
+
+// shellCommand runs a command through sh, like awk's system() and pipes. The
+// command is killed if the run is cancelled or goes over MaxDuration.
+func (i *Interpreter) shellCommand(command string) *exec.Cmd {
+	cmd := exec.CommandContext(i.deadline, "sh", "-c", command)
+	cmd.Stdout = i.Output
+	cmd.Stderr = os.Stderr
+	cmd.WaitDelay = commandWaitDelay
+	return cmd
+}
+
+// outputFor returns the stream that print > name, print >> name or
+// print | name writes to, opening it on first use.
+func (i *Interpreter) outputFor(redirect string, name string) *bufio.Writer {
+	if redirect == "|" {
+		i.checkSandbox("printing to a command")
+	} else {
+		i.checkSandbox("redirecting output to a file")
+	}
+	if stream, ok := i.outputs[name]; ok {
+		return stream.writer
+	}
+
+	stream := &outputStream{}
+	switch redirect {
+	case ">":
+		file, err := os.Create(name)
+		if err != nil {
+			panic("cannot open " + name + " for writing: " + err.Error())
+		}
+		stream.closer = file
+		stream.writer = bufio.NewWriter(file)
+	case ">>":
+		file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			panic("cannot open " + name + " for appending: " + err.Error())
+		}
+		stream.closer = file
+		stream.writer = bufio.NewWriter(file)
+	case "|":
+		stream.cmd = i.shellCommand(name)
+		stdin, err := stream.cmd.StdinPipe()
+		if err == nil {
+			err = stream.cmd.Start()
+		}
+		if err != nil {
+			panic("cannot run command " + name + ": " + err.Error())
+		}
+		stream.closer = stdin
+		stream.writer = bufio.NewWriter(stdin)
+	}
+	i.outputs[name] = stream
+	return stream.writer
+}
+
+// inputFor returns the stream that getline < name or name | getline reads
+// from, opening it on first use. It returns nil if the file cannot be opened.
+func (i *Interpreter) inputFor(name string, isCommand bool) *inputStream {
+	if isCommand {
+		i.checkSandbox("reading from a command")
+	} else {
+		i.checkSandbox("reading from a file")
+	}
+	if stream, ok := i.inputs[name]; ok {
+		return stream
+	}
+
+	stream := &inputStream{}
+	if isCommand {
+		stream.cmd = i.shellCommand(name)
+		stream.cmd.Stdin = os.Stdin
+		stream.cmd.Stdout = nil
+		stdout, err := stream.cmd.StdoutPipe()
+		if err == nil {
+			err = stream.cmd.Start()
+		}
+		if err != nil {
+			return nil
+		}
+		// commands the killed shell started can keep the pipe open, so
+		// a cancelled run closes it to end a getline waiting on them
+		stream.stop = context.AfterFunc(i.deadline, func() { stdout.Close() })
+		stream.reader = bufio.NewReader(stdout)
+	} else {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil
+		}
+		stream.closer = file
+		stream.reader = bufio.NewReader(file)
+	}
+	i.inputs[name] = stream
+	return stream
+}
+
+// getline reads the next line of a file or command into target, or $0 if
+// target is nil, and returns 1, 0 at the end of the input, or -1 if it
+// cannot be read.
+func (i *Interpreter) getline(name string, isCommand bool, target *location) ast.Expression {
+	stream := i.inputFor(name, isCommand)
+	if stream == nil {
+		return &ast.NumericLiteral{Value: -1}
+	}
+
+	line, err := stream.reader.ReadString('\n')
+	i.checkCancelled()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return &ast.NumericLiteral{Value: -1}
+	}
+	if line == "" {
+		return &ast.NumericLiteral{Value: 0}
+	}
+	line = strings.TrimSuffix(line, "\n")
+
+	if target == nil {
+		target = &location{lv: zeroField, field: "$0"}
+	}
+	i.store(target, literalValue(line))
+	return &ast.NumericLiteral{Value: 1}
+}
+
+// flushOutputs writes out everything printed to files and commands so far.
+func (i *Interpreter) flushOutputs() {
+	for _, stream := range i.outputs {
+		stream.writer.Flush()
+	}
+}
+
+// closeStream closes the file or command called name and returns its exit
+// status, or -1 if nothing by that name is open.
+func (i *Interpreter) closeStream(name string) int {
+	status := -1
+	if stream, ok := i.outputs[name]; ok {
+		delete(i.outputs, name)
+		stream.writer.Flush()
+		stream.closer.Close()
+		status = waitForCommand(stream.cmd)
+	}
+	if stream, ok := i.inputs[name]; ok {
+		delete(i.inputs, name)
+		if stream.closer != nil {
+			stream.closer.Close()
+		}
+		if stream.stop != nil {
+			stream.stop()
+		}
+		status = waitForCommand(stream.cmd)
+	}
+	return status
+}
+
+func (i *Interpreter) closeAllStreams() {
+	for name := range i.outputs {
+		i.closeStream(name)
+	}
+	for name := range i.inputs {
+		i.closeStream(name)
+	}
+}
+
+func waitForCommand(cmd *exec.Cmd) int {
+	if cmd == nil {
+		return 0
+	}
+	return exitStatus(cmd.Wait())
+}
+
+func exitStatus(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+// System runs a command through the shell after flushing pending output,
+// and returns its exit status.
+func System(i *Interpreter, args []ast.Expression) ast.Expression {
+	if len(args) != 1 {
+		panic("Incorrect number of arguments to function system")
+	}
+	i.checkSandbox("system()")
+	i.flushOutputs()
+	cmd := i.shellCommand(args[0].String())
+	cmd.Stdin = os.Stdin
+	status := exitStatus(cmd.Run())
+	i.checkCancelled()
+	return &ast.NumericLiteral{Value: float64(status)}
+}
+
+// Close closes a file or command opened by a redirection or getline and
+// returns its exit status.
+func Close(i *Interpreter, args []ast.Expression) ast.Expression {
+	if len(args) != 1 {
+		panic("Incorrect number of arguments to function close")
+	}
+	status := i.closeStream(args[0].String())
+	i.checkCancelled()
+	return &ast.NumericLiteral{Value: float64(status)}
+}
+
+// Fflush flushes the named output file or command, or all of them when
+// called without an argument.
+func Fflush(i *Interpreter, args []ast.Expression) ast.Expression {
+	if len(args) > 1 {
+		panic("Incorrect number of arguments to function fflush")
+	}
+	if len(args) == 0 {
+		i.flushOutputs()
+		return &ast.NumericLiteral{Value: 0}
+	}
+	stream, ok := i.outputs[args[0].String()]
+	if !ok {
+		return &ast.NumericLiteral{Value: -1}
+	}
+	stream.writer.Flush()
+	return &ast.NumericLiteral{Value: 0}
+}
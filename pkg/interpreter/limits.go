@@ -0,0 +1,166 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ahalbert/strawk/pkg/ast"
+)
+
+// Limits bounds the resources a program may use, so that untrusted programs
+// can be run safely. A zero value means no limit.
+type Limits struct {
+	MaxSteps        int           // statements executed, loop iterations and function calls
+	MaxDuration     time.Duration // wall time of a run, including commands it runs
+	MaxOutputBytes  int           // bytes printed to the output
+	MaxArraySize    int           // elements in any one array
+	MaxStringLength int           // bytes in a string built by concatenation or stored in a variable
+	MaxCallDepth    int           // nested calls of user-defined functions
+	DisableIO       bool          // turns off system(), getline, command pipes and file redirection
+}
+
+// ErrLimitExceeded is wrapped by the error Run returns when a program goes
+// over one of its Limits.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// LimitError reports which limit a program exceeded and where.
+type LimitError struct {
+	Limit string
+	Line  int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded on line %d", e.Limit, e.Line)
+}
+
+func (e *LimitError) Unwrap() error { return ErrLimitExceeded }
+
+// RuntimeError is returned when a run stops on an error or because the
+// context passed to RunContext is done, with the program line and input
+// offset the run had reached.
+type RuntimeError struct {
+	Line        int
+	InputOffset int
+	Err         error
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("Runtime Error on line %d at input offset %d: %v", e.Line, e.InputOffset, e.Err)
+}
+
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// stepsBetweenClockChecks is how often step looks at the deadline, since
+// reading the clock on every step would dominate simple programs.
+const stepsBetweenClockChecks = 1024
+
+func (i *Interpreter) currentLine() int {
+	return i.line
+}
+
+func (i *Interpreter) exceeded(limit string) {
+	panic(&LimitError{Limit: limit, Line: i.currentLine()})
+}
+
+// checkCancelled stops the run if the context passed to RunContext is done,
+// or if it has run for longer than MaxDuration. It is called at rule
+// boundaries, function calls and after external commands, and through step
+// as the program runs.
+func (i *Interpreter) checkCancelled() {
+	select {
+	case <-i.ctx.Done():
+		panic(&RuntimeError{Line: i.currentLine(), InputOffset: i.InputPostion, Err: i.ctx.Err()})
+	default:
+	}
+	if i.deadline.Err() != nil {
+		i.exceeded("time")
+	}
+}
+
+// startLimits arms the limits for a run under ctx and returns a function
+// that releases the resources they hold.
+func (i *Interpreter) startLimits(ctx context.Context) func() {
+	i.steps = 0
+	i.ctx = ctx
+	i.deadline = ctx
+	cancel := func() {}
+	if i.Limits.MaxDuration > 0 {
+		i.deadline, cancel = context.WithTimeout(ctx, i.Limits.MaxDuration)
+	}
+	out := i.Output
+	if i.Limits.MaxOutputBytes > 0 {
+		i.Output = &limitedWriter{w: out, remaining: i.Limits.MaxOutputBytes}
+	}
+	return func() {
+		cancel()
+		i.Output = out
+	}
+}
+
+// step counts one unit of work against MaxSteps and checks the deadline.
+func (i *Interpreter) step() {
+	i.steps++
+	if i.Limits.MaxSteps > 0 && i.steps > i.Limits.MaxSteps {
+		i.exceeded("step")
+	}
+	if i.steps%stepsBetweenClockChecks == 0 {
+		i.checkCancelled()
+		if out, ok := i.Output.(*limitedWriter); ok && out.isExceeded() {
+			i.exceeded("output")
+		}
+	}
+}
+
+func (i *Interpreter) checkStringLength(v value) {
+	if v.kind == stringKind && i.Limits.MaxStringLength > 0 && len(v.str) > i.Limits.MaxStringLength {
+		i.exceeded("string length")
+	}
+}
+
+// checkCallDepth stops a run whose function calls nest deeper than
+// MaxCallDepth, before runaway recursion exhausts the Go stack.
+func (i *Interpreter) checkCallDepth() {
+	if i.Limits.MaxCallDepth > 0 && i.callDepth > i.Limits.MaxCallDepth {
+		i.exceeded("call depth")
+	}
+}
+
+func (i *Interpreter) checkArraySize(array *ast.AssociativeArray) {
+	if i.Limits.MaxArraySize > 0 && len(array.Array) > i.Limits.MaxArraySize {
+		i.exceeded("array size")
+	}
+}
+
+// limitedWriter stops writing once a number of bytes has been written. It
+// returns an error rather than panicking, as commands started by system()
+// and pipes write to the output from other goroutines.
+type limitedWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	remaining int
+	exceeded  bool
+}
+
+func (lw *limitedWriter) isExceeded() bool {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.exceeded
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	if len(p) > lw.remaining {
+		n, _ := lw.w.Write(p[:lw.remaining])
+		lw.remaining -= n
+		lw.exceeded = true
+		return n, ErrLimitExceeded
+	}
+	n, err := lw.w.Write(p)
+	lw.remaining -= n
+	return n, err
+}
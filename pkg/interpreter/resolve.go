@@ -0,0 +1,537 @@
+package interpreter
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ahalbert/strawk/pkg/ast"
+)
+
+// Scope says what a variable name refers to.
+type Scope int
+
+const (
+	ScopeGlobal       Scope = iota
+	ScopeParam              // a parameter that callers pass
+	ScopeLocal              // a parameter no call passes, used as a local variable
+	ScopeCaptureGroup       // $0, or a capture group named by one of the program's regexes
+	ScopeSpecial            // set by the interpreter, like $MATCHES and RSTART
+)
+
+func (s Scope) String() string {
+	return [...]string{"global", "parameter", "local", "capture group", "special"}[s]
+}
+
+// specialVariables are the variables the interpreter sets or reads itself.
+var specialVariables = map[string]bool{
+	"$MATCHES": true, "$RSTART": true, "$RLENGTH": true,
+	"$OFFSET": true, "$LINE": true, "$COLUMN": true,
+	"SUBSEP": true, "RSTART": true, "RLENGTH": true, "PROCINFO": true,
+}
+
+// Variable is a name resolved to where it is stored.
+type Variable struct {
+	Name  string
+	Scope Scope
+	Slot  int // index among the globals or the function's parameters, -1 for $ names
+}
+
+// FunctionInfo describes a user-defined function.
+type FunctionInfo struct {
+	Literal *ast.FunctionLiteral
+	Index   int
+	Calls   int // call sites in the program
+	MaxArgs int // most arguments any call passes; later parameters are locals
+}
+
+// Call is a call to a function the program does not define.
+type Call struct {
+	Name string
+	Line int
+}
+
+// VariableUse is where a variable is first used, inside Function or outside
+// any function if Function is empty.
+type VariableUse struct {
+	Name     string
+	Function string
+	Line     int
+}
+
+// Resolution is the result of resolving a program's variables: where each
+// one is stored, how it is used, and misuse found without running it.
+type Resolution struct {
+	Globals   []string // global variables, indexed by slot
+	Functions map[string]*FunctionInfo
+	Undefined []Call   // calls to functions that are neither built in nor defined
+	Errors    []string // formatted like parse errors
+
+	globalSlots map[string]int
+	groups      map[string]bool // names of capture groups in the program's regexes
+	usage       map[usageKey]*usage
+	uses        int // number of scalar and array uses recorded, to order them
+}
+
+// usageKey identifies a variable: a global, or a parameter of fn.
+type usageKey struct {
+	fn   *ast.FunctionLiteral
+	name string
+}
+
+// usage records where a variable is first used, and first used as a scalar
+// and as an array. scalarOrder and arrayOrder say which of those came first.
+type usage struct {
+	line        int
+	scalarLine  int
+	arrayLine   int
+	scalarOrder int
+	arrayOrder  int
+	reads       int
+	writes      int
+}
+
+type resolver struct {
+	res    *Resolution
+	fn     *ast.FunctionLiteral
+	line   int
+	fields []fieldOperand
+}
+
+// fieldOperand is a variable used as the operand of $.
+type fieldOperand struct {
+	fn    *ast.FunctionLiteral
+	ident *ast.Identifier
+	line  int
+}
+
+// Resolve classifies every variable of a program and assigns globals their
+// slots. It reports a variable used as both a scalar and an array, a call
+// with more arguments than the function has parameters, and functions that
+// are defined twice or redefine a built-in.
+func Resolve(program *ast.Program) *Resolution {
+	res := &Resolution{
+		Functions:   make(map[string]*FunctionInfo),
+		globalSlots: make(map[string]int),
+		groups:      make(map[string]bool),
+		usage:       make(map[usageKey]*usage),
+	}
+	res.global("SUBSEP") // subsepSlot
+
+	for _, stmt := range program.Statements {
+		fl, ok := stmt.(*ast.FunctionLiteral)
+		if !ok {
+			continue
+		}
+		name := fl.Name.Value
+		switch {
+		case builtins[name].fn != nil:
+			res.errorf(fl.Token.LineNum, "cannot redefine built-in function %s", name)
+		case res.Functions[name] != nil:
+			res.errorf(fl.Token.LineNum, "function %s is defined more than once", name)
+		default:
+			res.Functions[name] = &FunctionInfo{Literal: fl, Index: len(res.Functions)}
+		}
+	}
+
+	r := &resolver{res: res}
+	for _, stmt := range program.Statements {
+		r.fn = nil
+		if fl, ok := stmt.(*ast.FunctionLiteral); ok {
+			if info := res.Functions[fl.Name.Value]; info == nil || info.Literal != fl {
+				continue
+			}
+			r.fn = fl
+			r.statements(fl.Body.Statements)
+			continue
+		}
+		r.statement(stmt)
+	}
+	// $name refers to a capture group if any regex names one, so field
+	// operands are only known to be variables once every regex is seen
+	for _, field := range r.fields {
+		r.fn = field.fn
+		if res.groups[field.ident.Value] {
+			r.use(field.ident.Value, field.line)
+		} else {
+			r.scalar(field.ident.Value, field.line).reads++
+		}
+	}
+	res.checkUsage()
+	return res
+}
+
+func (res *Resolution) errorf(line int, format string, args ...any) {
+	res.Errors = append(res.Errors, fmt.Sprintf("Error on line %d: %s\n\n", line, fmt.Sprintf(format, args...)))
+}
+
+func (res *Resolution) global(name string) int {
+	if slot, ok := res.globalSlots[name]; ok {
+		return slot
+	}
+	res.globalSlots[name] = len(res.Globals)
+	res.Globals = append(res.Globals, name)
+	return res.globalSlots[name]
+}
+
+// Lookup resolves a name used inside fn, or outside any function if fn is nil.
+func (res *Resolution) Lookup(fn *ast.FunctionLiteral, name string) Variable {
+	if strings.HasPrefix(name, "$") {
+		if specialVariables[name] {
+			return Variable{Name: name, Scope: ScopeSpecial, Slot: -1}
+		}
+		return Variable{Name: name, Scope: ScopeCaptureGroup, Slot: -1}
+	}
+	if fn != nil {
+		if idx := slices.IndexFunc(fn.Parameters, func(p ast.Identifier) bool { return p.Value == name }); idx >= 0 {
+			info := res.Functions[fn.Name.Value]
+			if info != nil && info.Calls > 0 && idx >= info.MaxArgs {
+				return Variable{Name: name, Scope: ScopeLocal, Slot: idx}
+			}
+			return Variable{Name: name, Scope: ScopeParam, Slot: idx}
+		}
+	}
+	scope := ScopeGlobal
+	if specialVariables[name] {
+		scope = ScopeSpecial
+	}
+	slot, ok := res.globalSlots[name]
+	if !ok {
+		slot = -1
+	}
+	return Variable{Name: name, Scope: scope, Slot: slot}
+}
+
+// IsCaptureGroup reports whether $name can refer to a named capture group.
+func (res *Resolution) IsCaptureGroup(name string) bool {
+	return res.groups[name]
+}
+
+// Reads and Writes report how many times a global variable is read and
+// assigned in the program.
+func (res *Resolution) Reads(name string) int  { return res.usageOf(nil, name).reads }
+func (res *Resolution) Writes(name string) int { return res.usageOf(nil, name).writes }
+
+// Unassigned lists the variables that are read but never assigned, in the
+// order they are first used. Parameters that callers pass are left out, as is
+// a variable passed to a user-defined function, which may fill it as an array.
+func (res *Resolution) Unassigned() []VariableUse {
+	var uses []VariableUse
+	for key, u := range res.usage {
+		if u.writes > 0 || u.reads == 0 {
+			continue
+		}
+		use := VariableUse{Name: key.name, Line: u.line}
+		if key.fn != nil {
+			if res.Lookup(key.fn, key.name).Scope == ScopeParam {
+				continue
+			}
+			use.Function = key.fn.Name.Value
+		}
+		uses = append(uses, use)
+	}
+	slices.SortFunc(uses, func(a, b VariableUse) int {
+		return cmp.Or(cmp.Compare(a.Line, b.Line), strings.Compare(a.Function, b.Function), strings.Compare(a.Name, b.Name))
+	})
+	return uses
+}
+
+func (res *Resolution) usageOf(fn *ast.FunctionLiteral, name string) *usage {
+	if u, ok := res.usage[usageKey{fn, name}]; ok {
+		return u
+	}
+	return &usage{}
+}
+
+// checkUsage reports variables used both as scalars and as arrays, at
+// whichever use comes second.
+func (res *Resolution) checkUsage() {
+	var keys []usageKey
+	for key, u := range res.usage {
+		if u.scalarOrder > 0 && u.arrayOrder > 0 {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b usageKey) int {
+		lineA := max(res.usage[a].scalarLine, res.usage[a].arrayLine)
+		lineB := max(res.usage[b].scalarLine, res.usage[b].arrayLine)
+		return cmp.Or(cmp.Compare(lineA, lineB), strings.Compare(a.name, b.name))
+	})
+	for _, key := range keys {
+		u := res.usage[key]
+		if u.scalarOrder < u.arrayOrder {
+			res.errorf(u.arrayLine, "attempt to use scalar %s as array", key.name)
+		} else {
+			res.errorf(u.scalarLine, "attempt to use array %s in a scalar context", key.name)
+		}
+	}
+}
+
+func (r *resolver) lineOf(node ast.Node) int {
+	if line := node.GetToken().LineNum; line > 0 {
+		return line
+	}
+	return r.line
+}
+
+// use records a use of a variable name on a line. Parameters are tracked per
+// function; $ names and special variables are not tracked.
+func (r *resolver) use(name string, line int) *usage {
+	v := r.res.Lookup(r.fn, name)
+	if name == "" || v.Scope == ScopeCaptureGroup || v.Scope == ScopeSpecial {
+		return &usage{}
+	}
+	key := usageKey{name: name}
+	if v.Scope == ScopeParam || v.Scope == ScopeLocal {
+		key.fn = r.fn
+	} else {
+		r.res.global(name)
+	}
+	u, ok := r.res.usage[key]
+	if !ok {
+		u = &usage{}
+		r.res.usage[key] = u
+	}
+	if u.line == 0 {
+		u.line = line
+	}
+	return u
+}
+
+func (r *resolver) scalar(name string, line int) *usage {
+	u := r.use(name, line)
+	if u.scalarOrder == 0 {
+		r.res.uses++
+		u.scalarLine, u.scalarOrder = line, r.res.uses
+	}
+	return u
+}
+
+func (r *resolver) array(name string, line int) *usage {
+	u := r.use(name, line)
+	if u.arrayOrder == 0 {
+		r.res.uses++
+		u.arrayLine, u.arrayOrder = line, r.res.uses
+	}
+	return u
+}
+
+func (r *resolver) statements(statements []ast.Statement) {
+	for _, stmt := range statements {
+		r.statement(stmt)
+	}
+}
+
+func (r *resolver) statement(stmt ast.Statement) {
+	if stmt == nil {
+		return
+	}
+	if line := stmt.GetToken().LineNum; line > 0 {
+		r.line = line
+	}
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		for _, expr := range stmt.Expressions {
+			r.expression(expr)
+		}
+	case *ast.PrintStatement:
+		r.scalars(stmt.Expressions...)
+		if stmt.Destination != nil {
+			r.scalars(stmt.Destination)
+		}
+	case *ast.AssignStatement:
+		for idx, target := range stmt.Targets {
+			r.assign(target, stmt.Values[idx])
+		}
+	case *ast.ActionBlockStatement:
+		r.scalars(stmt.Conditon)
+		r.statements(stmt.Statements.Statements)
+	case *ast.BeginStatement:
+		r.statements(stmt.Statements)
+	case *ast.EndStatement:
+		r.statements(stmt.Statements)
+	case *ast.IfStatement:
+		r.scalars(stmt.Conditions...)
+		for _, block := range stmt.Consequences {
+			r.statements(block.Statements)
+		}
+		if stmt.Else != nil {
+			r.statements(stmt.Else.Statements)
+		}
+	case *ast.WhileStatement:
+		r.scalars(stmt.Condition)
+		r.statements(stmt.Block.Statements)
+	case *ast.DoWhileStatement:
+		r.statements(stmt.Block.Statements)
+		r.scalars(stmt.Condition)
+	case *ast.ForStatement:
+		r.statement(stmt.Initialization)
+		if stmt.Condition != nil {
+			r.scalars(stmt.Condition)
+		}
+		r.statement(stmt.Action)
+		r.statements(stmt.Block.Statements)
+	case *ast.ForEachStatement:
+		r.scalar(stmt.VarName.Value, r.lineOf(stmt.VarName)).writes++
+		r.arrayOperand(stmt.Array).reads++
+		r.statements(stmt.Block.Statements)
+	case *ast.DeleteStatement:
+		r.arrayOperand(stmt.ToDelete).writes++
+	case *ast.ReturnStatement:
+		if stmt.Value != nil {
+			r.expression(stmt.Value)
+		}
+	}
+}
+
+// scalars resolves expressions whose values must be scalars.
+func (r *resolver) scalars(exprs ...ast.Expression) {
+	for _, expr := range exprs {
+		if ident, ok := expr.(*ast.Identifier); ok {
+			r.scalar(ident.Value, r.lineOf(ident)).reads++
+			continue
+		}
+		r.expression(expr)
+	}
+}
+
+// arrayOperand resolves an expression that must be an array: a variable, or
+// the element a[i] holding a subarray. It returns the usage of the variable.
+func (r *resolver) arrayOperand(expr ast.Expression) *usage {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return r.array(expr.Value, r.lineOf(expr))
+	case *ast.ArrayIndexExpression:
+		return r.element(expr)
+	default:
+		r.expression(expr)
+		return &usage{}
+	}
+}
+
+// element resolves a[i], a[i][j], ... and its subscripts, and returns the
+// usage of the array variable.
+func (r *resolver) element(expr *ast.ArrayIndexExpression) *usage {
+	var u *usage
+	if expr.Parent != nil {
+		u = r.element(expr.Parent)
+	} else {
+		u = r.array(expr.ArrayName, r.lineOf(expr))
+	}
+	r.scalars(expr.IndexList...)
+	return u
+}
+
+func (r *resolver) assign(target ast.Expression, value ast.Expression) {
+	r.scalars(value)
+	r.target(target)
+}
+
+// target resolves a variable, element or field that is assigned a scalar.
+func (r *resolver) target(target ast.Expression) {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		r.scalar(target.Value, r.lineOf(target)).writes++
+	case *ast.ArrayIndexExpression:
+		r.element(target).writes++
+	default:
+		r.expression(target)
+	}
+}
+
+func (r *resolver) expression(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		r.use(expr.Value, r.lineOf(expr)).reads++
+	case *ast.ArrayIndexExpression:
+		if expr.ArrayName == "" {
+			r.scalars(expr.IndexList...)
+			return
+		}
+		r.element(expr).reads++
+	case *ast.FieldExpression:
+		if ident, ok := expr.Index.(*ast.Identifier); ok {
+			r.fields = append(r.fields, fieldOperand{fn: r.fn, ident: ident, line: r.lineOf(ident)})
+			return
+		}
+		r.scalars(expr.Index)
+	case *ast.RegexLiteral:
+		if re, err := regexp.Compile(expr.Value); err == nil {
+			for _, name := range re.SubexpNames() {
+				r.res.groups[name] = true
+			}
+		}
+	case *ast.AssignExpression:
+		if expr.Operator.Literal != "=" {
+			r.scalars(expr.Target)
+		}
+		r.assign(expr.Target, expr.Value)
+	case *ast.TernaryExpression:
+		r.scalars(expr.Condition, expr.IfTrue, expr.IfFalse)
+	case *ast.PrefixExpression:
+		r.scalars(expr.Right)
+		if expr.Operator == "++" || expr.Operator == "--" {
+			r.target(expr.Right)
+		}
+	case *ast.PostfixExpression:
+		r.scalars(expr.Left)
+		r.target(expr.Left)
+	case *ast.InfixExpression:
+		if expr.Operator == "in" {
+			r.scalars(expr.Left)
+			r.arrayOperand(expr.Right).reads++
+			return
+		}
+		r.scalars(expr.Left, expr.Right)
+	case *ast.GetlineExpression:
+		if expr.Command != nil {
+			r.scalars(expr.Command)
+		}
+		if expr.File != nil {
+			r.scalars(expr.File)
+		}
+		if expr.Target != nil {
+			r.target(expr.Target)
+		}
+	case *ast.CallExpression:
+		r.call(expr)
+	}
+}
+
+func (r *resolver) call(call *ast.CallExpression) {
+	name := call.Function.String()
+	line := r.lineOf(call)
+	if b, ok := builtins[name]; ok {
+		for idx, arg := range call.Arguments {
+			switch {
+			case slices.Contains(b.arrays, idx):
+				r.arrayOperand(arg).writes++
+			case (name == "sub" || name == "gsub") && idx == 2:
+				r.scalars(arg)
+				r.target(arg)
+			default:
+				r.expression(arg)
+			}
+		}
+		return
+	}
+
+	for _, arg := range call.Arguments {
+		r.expression(arg)
+		if ident, ok := arg.(*ast.Identifier); ok {
+			r.use(ident.Value, line).writes++
+		}
+	}
+	info, ok := r.res.Functions[name]
+	if !ok {
+		r.res.Undefined = append(r.res.Undefined, Call{Name: name, Line: line})
+		return
+	}
+	info.Calls++
+	info.MaxArgs = max(info.MaxArgs, len(call.Arguments))
+	if params := len(info.Literal.Parameters); len(call.Arguments) > params {
+		r.res.errorf(line, "function %s called with %d arguments, but accepts only %d", name, len(call.Arguments), params)
+	}
+}
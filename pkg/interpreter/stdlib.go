@@ -1,18 +1,27 @@
 package interpreter
 
 import (
+	"cmp"
+	"fmt"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ahalbert/strawk/pkg/ast"
 )
 
+// Length returns the number of characters in a string, $0 by default, or of
+// elements in an array.
 func Length(i *Interpreter, args []ast.Expression) ast.Expression {
 
-	if len(args) != 1 {
+	if len(args) > 1 {
 		panic("Incorrect arguments to function length")
 	}
+	if len(args) == 0 {
+		args = []ast.Expression{i.lookupField("$0")}
+	}
 
 	var ret float64
 	switch args[0].(type) {
@@ -30,91 +39,109 @@ func Length(i *Interpreter, args []ast.Expression) ast.Expression {
 	return &ast.NumericLiteral{Value: ret}
 }
 
-func Sub(i *Interpreter, args []ast.Expression) ast.Expression {
-	var in ast.Expression
-	if len(args) < 2 || len(args) > 3 {
-		panic("Incorrect arguments to function sub")
-	}
-	if len(args) == 2 {
-		in = i.lookupVar(&ast.Identifier{Value: "$0"})
-	} else {
-		in = args[2]
-	}
-
-	switch args[0].(type) {
-	case *ast.RegexLiteral:
-	default:
-		panic("first argument to function sub is not a regex")
-	}
-
-	switch args[1].(type) {
-	case *ast.StringLiteral:
-	case *ast.NumericLiteral:
-	default:
-		panic("second argument to function sub is not a scalar")
-	}
-
-	switch in.(type) {
-	case *ast.StringLiteral:
-	case *ast.NumericLiteral:
-	default:
-		panic("third argument to function sub is not a scalar")
+// IsArray reports whether its argument is an array, such as a[k] after
+// a[k][j] has been assigned.
+func IsArray(i *Interpreter, args []ast.Expression) ast.Expression {
+	if len(args) != 1 {
+		panic("Incorrect number of arguments to function isarray")
 	}
+	_, ok := args[0].(*ast.AssociativeArray)
+	return boolToExpression(ok)
+}
 
-	re, err := regexp.Compile(args[0].(*ast.RegexLiteral).Value)
-	if err != nil {
-		panic("First argument to sub not a valid regex")
-	}
-	found := re.FindString(in.String())
-	replaced := in.String()
-	if found != "" {
-		replaced = strings.Replace(in.String(), found, args[1].String(), 1)
-	}
-	return ast.NewLiteral(replaced)
+// Sub replaces the first match of a regex in a variable, $0 by default, and
+// returns the number of replacements made.
+func Sub(i *Interpreter, args []ast.Expression) ast.Expression {
+	return substitute(i, args, "sub", false)
 }
 
+// Gsub replaces every match of a regex in a variable, $0 by default, and
+// returns the number of replacements made.
 func Gsub(i *Interpreter, args []ast.Expression) ast.Expression {
-	var in ast.Expression
+	return substitute(i, args, "gsub", true)
+}
+
+func substitute(i *Interpreter, args []ast.Expression, function string, global bool) ast.Expression {
 	if len(args) < 2 || len(args) > 3 {
-		panic("Incorrect arguments to function sub")
+		panic("Incorrect arguments to function " + function)
 	}
+
+	var target *location
+	var in ast.Expression
 	if len(args) == 2 {
-		in = i.lookupVar(&ast.Identifier{Value: "$0"})
+		target = &location{lv: zeroField, field: "$0"}
+		in = i.load(target).expression()
 	} else {
+		target = i.argumentLocation(2)
 		in = args[2]
 	}
 
-	switch args[0].(type) {
-	case *ast.RegexLiteral:
-	default:
-		panic("first argument to function sub is not a regex")
-	}
+	re := regexArgument(args[0], function)
 
 	switch args[1].(type) {
 	case *ast.StringLiteral:
 	case *ast.NumericLiteral:
 	default:
-		panic("second argument to function sub is not a scalar")
+		panic("second argument to function " + function + " is not a scalar")
 	}
 
 	switch in.(type) {
 	case *ast.StringLiteral:
 	case *ast.NumericLiteral:
 	default:
-		panic("third argument to function sub is not a scalar")
+		panic("third argument to function " + function + " is not a scalar")
 	}
 
-	re, err := regexp.Compile(args[0].(*ast.RegexLiteral).Value)
-	if err != nil {
-		panic("First argument to sub not a valid regex")
+	if target == nil {
+		panic("third argument to function " + function + " is not a variable")
+	}
+
+	str := in.String()
+	replacement := args[1].String()
+	var out strings.Builder
+	count := 0
+	last := 0
+	for _, loc := range re.FindAllStringIndex(str, -1) {
+		out.WriteString(str[last:loc[0]])
+		out.WriteString(expandReplacement(replacement, str[loc[0]:loc[1]]))
+		last = loc[1]
+		count++
+		if !global {
+			break
+		}
 	}
+	if count > 0 {
+		out.WriteString(str[last:])
+		i.store(target, literalValue(out.String()))
+	}
+	return &ast.NumericLiteral{Value: float64(count)}
+}
 
-	replaced := re.ReplaceAllString(in.String(), args[1].String())
-	return ast.NewLiteral(replaced)
+// expandReplacement substitutes the matched text for each & in the
+// replacement of sub and gsub. \& stands for a literal & and \\ for a
+// literal backslash.
+func expandReplacement(replacement string, matched string) string {
+	var out strings.Builder
+	for idx := 0; idx < len(replacement); idx++ {
+		switch {
+		case replacement[idx] == '\\' && idx+1 < len(replacement) && (replacement[idx+1] == '&' || replacement[idx+1] == '\\'):
+			idx++
+			out.WriteByte(replacement[idx])
+		case replacement[idx] == '&':
+			out.WriteString(matched)
+		default:
+			out.WriteByte(replacement[idx])
+		}
+	}
+	return out.String()
 }
 
+// Split fills an array with the pieces of a string and returns how many
+// there are. A separator of a single space, the default, splits on runs of
+// blanks and newlines; any other single character is used literally, and
+// longer separators are regexes.
 func Split(i *Interpreter, args []ast.Expression) ast.Expression {
-	if len(args) != 2 {
+	if len(args) < 2 || len(args) > 3 {
 		panic("Incorrect arguments to function split")
 	}
 
@@ -122,21 +149,36 @@ func Split(i *Interpreter, args []ast.Expression) ast.Expression {
 	case *ast.StringLiteral:
 	case *ast.NumericLiteral:
 	default:
-		panic("first argument to function sub is not a regex")
+		panic("first argument to function split is not a scalar")
 	}
 
-	switch args[1].(type) {
-	case *ast.StringLiteral:
-	case *ast.NumericLiteral:
-	default:
-		panic("second argument to function sub is not a scalar")
+	array := i.arrayArgument(1)
+	array.Clear()
+
+	str := args[0].String()
+	var splits []string
+	if len(args) == 2 || args[2].String() == " " {
+		splits = strings.Fields(str)
+	} else if str == "" {
+		splits = nil
+	} else {
+		switch sep := args[2].(type) {
+		case *ast.RegexLiteral:
+			splits = regexArgument(sep, "split").Split(str, -1)
+		default:
+			if len(sep.String()) == 1 {
+				splits = strings.Split(str, sep.String())
+			} else {
+				splits = regexArgument(sep, "split").Split(str, -1)
+			}
+		}
 	}
-	splits := strings.Split(args[0].String(), args[1].String())
-	ret := make(map[string]ast.Expression)
+
 	for idx, split := range splits {
-		ret[strconv.Itoa(idx+1)] = &ast.StringLiteral{Value: split}
+		array.Set(strconv.Itoa(idx+1), ast.NewLiteral(split))
 	}
-	return &ast.AssociativeArray{Array: ret}
+	i.checkArraySize(array)
+	return &ast.NumericLiteral{Value: float64(len(splits))}
 }
 
 func ToLower(i *Interpreter, args []ast.Expression) ast.Expression {
@@ -169,72 +211,49 @@ func ToUpper(i *Interpreter, args []ast.Expression) ast.Expression {
 	return ast.NewLiteral(ret)
 }
 
+// Substr returns at most n characters of s starting at the 1-based position
+// m. Positions are rounded and clipped to the string, as in POSIX awk.
 func Substr(i *Interpreter, args []ast.Expression) ast.Expression {
 	if len(args) < 2 || len(args) > 3 {
 		panic("Incorrect number of arguments to function substr")
 	}
 
-	var s string
 	switch args[0].(type) {
 	case *ast.StringLiteral:
 	case *ast.NumericLiteral:
 	default:
 		panic("first argument to function substr is not a scalar.")
 	}
-	s = args[0].String()
+	s := args[0].String()
 
-	var m int
 	switch args[1].(type) {
 	case *ast.StringLiteral:
-		val, err := strconv.Atoi(args[1].String())
-		if err != nil {
-			panic("second argument to function substr is not an integer.")
-		}
-		m = val
 	case *ast.NumericLiteral:
-		val := args[1].(*ast.NumericLiteral).Value
-		if val == float64(int(val)) {
-			m = int(val)
-		} else {
-			panic("second argument to function substr is not an integer.")
-		}
 	default:
 		panic("second argument to function substr is not a scalar.")
 	}
+	start := math.RoundToEven(convertLiteralForMathOp(args[1]))
 
-	var n int
-	if len(args) == 2 {
-		n = -1
-	} else {
+	end := math.Inf(1)
+	if len(args) == 3 {
 		switch args[2].(type) {
 		case *ast.StringLiteral:
-			val, err := strconv.Atoi(args[2].String())
-			if err != nil {
-				panic("second argument to function substr is not an integer.")
-			}
-			n = val
 		case *ast.NumericLiteral:
-			val := args[2].(*ast.NumericLiteral).Value
-			if val == float64(int(val)) {
-				n = int(val)
-			} else {
-				panic("second argument to function substr is not an integer.")
-			}
 		default:
-			panic("second argument to function substr is not a scalar.")
+			panic("third argument to function substr is not a scalar.")
 		}
+		end = start + math.RoundToEven(convertLiteralForMathOp(args[2]))
 	}
 
-	if m >= len(s) {
-		return ast.NewLiteral("")
-	}
-	if m+n >= len(s) || n == -1 {
-		return ast.NewLiteral(s[m:])
+	start = math.Max(start, 1)
+	end = math.Min(end, float64(len(s)+1))
+	if end <= start {
+		return &ast.StringLiteral{Value: ""}
 	}
-
-	return ast.NewLiteral(s[m : m+n])
+	return ast.NewLiteral(s[int(start)-1 : int(end)-1])
 }
 
+// Index returns the 1-based position of t in s, or 0 if it does not occur.
 func Index(i *Interpreter, args []ast.Expression) ast.Expression {
 	if len(args) != 2 {
 		panic("Incorrect number of arguments to function index")
@@ -253,11 +272,127 @@ func Index(i *Interpreter, args []ast.Expression) ast.Expression {
 		panic("second argument to function index is not a scalar.")
 	}
 	ret := strings.Index(args[0].String(), args[1].String())
-	return ast.NewLiteral(strconv.Itoa(ret))
+	return &ast.NumericLiteral{Value: float64(ret + 1)}
+}
+
+// Sprintf formats its arguments according to a printf style format string.
+func Sprintf(i *Interpreter, args []ast.Expression) ast.Expression {
+	if len(args) < 1 {
+		panic("Incorrect number of arguments to function sprintf")
+	}
+	switch args[0].(type) {
+	case *ast.StringLiteral:
+	case *ast.NumericLiteral:
+	default:
+		panic("first argument to function sprintf is not a scalar.")
+	}
+	return &ast.StringLiteral{Value: i.formatString(args[0].String(), args[1:])}
+}
+
+// maxFormatWidth bounds the width and precision of a conversion when
+// MaxStringLength does not. fmt prints an error in place of the value past
+// it.
+const maxFormatWidth = 1_000_000
+
+// formatString implements the conversions of awk's printf: %c, %d, %i, %o,
+// %x, %X, %u, %e, %E, %f, %F, %g, %G, %s and %%, with flags, width and
+// precision, where * takes the width or precision from the arguments.
+func (i *Interpreter) formatString(format string, args []ast.Expression) string {
+	var out strings.Builder
+	nextArg := func() ast.Expression {
+		if len(args) == 0 {
+			panic("not enough arguments for format " + format)
+		}
+		arg := args[0]
+		args = args[1:]
+		return arg
+	}
+	readNumber := func(idx int) (string, int) {
+		var number string
+		if idx < len(format) && format[idx] == '*' {
+			number, idx = strconv.Itoa(int(convertLiteralForMathOp(nextArg()))), idx+1
+		} else {
+			start := idx
+			for idx < len(format) && '0' <= format[idx] && format[idx] <= '9' {
+				idx++
+			}
+			number = format[start:idx]
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(number, "-"))
+		switch {
+		case number == "":
+		case err != nil || n > maxFormatWidth:
+			panic("width or precision " + number + " in format " + format + " is too large")
+		case i.Limits.MaxStringLength > 0 && n > i.Limits.MaxStringLength:
+			i.exceeded("string length")
+		}
+		return number, idx
+	}
+
+	for idx := 0; idx < len(format); idx++ {
+		if format[idx] != '%' {
+			out.WriteByte(format[idx])
+			continue
+		}
+		start := idx
+		idx++
+		for idx < len(format) && strings.IndexByte("-+ #0", format[idx]) >= 0 {
+			idx++
+		}
+		spec := format[start:idx]
+		var width string
+		width, idx = readNumber(idx)
+		spec += width
+		if idx < len(format) && format[idx] == '.' {
+			var precision string
+			precision, idx = readNumber(idx + 1)
+			spec += "." + precision
+		}
+		if idx >= len(format) {
+			out.WriteString(format[start:])
+			break
+		}
+
+		switch verb := format[idx]; verb {
+		case '%':
+			out.WriteByte('%')
+		case 'd', 'i':
+			fmt.Fprintf(&out, spec+"d", int64(convertLiteralForMathOp(nextArg())))
+		case 'o', 'x', 'X', 'u':
+			if verb == 'u' {
+				verb = 'd'
+			}
+			fmt.Fprintf(&out, spec+string(verb), uint64(int64(convertLiteralForMathOp(nextArg()))))
+		case 'e', 'E', 'f', 'F', 'g', 'G':
+			fmt.Fprintf(&out, spec+string(verb), convertLiteralForMathOp(nextArg()))
+		case 'c':
+			arg := nextArg()
+			var char string
+			switch arg.(type) {
+			case *ast.NumericLiteral:
+				char = string(rune(int(arg.(*ast.NumericLiteral).Value)))
+			default:
+				char = arg.String()
+				if len(char) > 0 {
+					char = char[:1]
+				}
+			}
+			fmt.Fprintf(&out, spec+"s", char)
+		case 's':
+			fmt.Fprintf(&out, spec+"s", nextArg().String())
+		default:
+			out.WriteString(format[start : idx+1])
+		}
+	}
+	return out.String()
 }
 
+// Match returns the 1-based position of the first match of a regex in a
+// string, or 0, and sets RSTART and RLENGTH. Given an array as third argument
+// it is filled with the text of each group, along with its start and length
+// under the keys (n, "start") and (n, "length").
 func Match(i *Interpreter, args []ast.Expression) ast.Expression {
-	if len(args) != 2 {
+	if len(args) < 2 || len(args) > 3 {
 		panic("Incorrect number of arguments to function match")
 	}
 	switch args[0].(type) {
@@ -267,19 +402,436 @@ func Match(i *Interpreter, args []ast.Expression) ast.Expression {
 		panic("first argument to function match is not a scalar.")
 	}
 
-	switch args[1].(type) {
+	re := regexArgument(args[1], "match")
+	loc := re.FindStringSubmatchIndex(args[0].String())
+
+	if len(args) == 3 {
+		array := i.arrayArgument(2)
+		array.Clear()
+		if loc != nil {
+			match := newRegexMatch(args[0].String(), loc, re.SubexpNames())
+			for idx := 0; idx < len(match.Spans)/2; idx++ {
+				start, end := match.Spans[2*idx], match.Spans[2*idx+1]
+				if start < 0 {
+					continue
+				}
+				keys := []string{strconv.Itoa(idx)}
+				if match.Names[idx] != "" {
+					keys = append(keys, match.Names[idx])
+				}
+				for _, key := range keys {
+					array.Set(key, ast.NewLiteral(match.Text[start:end]))
+					array.Set(i.joinSubscripts(key, "start"), &ast.NumericLiteral{Value: float64(loc[0] + start + 1)})
+					array.Set(i.joinSubscripts(key, "length"), &ast.NumericLiteral{Value: float64(end - start)})
+				}
+			}
+		}
+		i.checkArraySize(array)
+	}
+
+	if loc == nil {
+		i.SetGlobal("RSTART", &ast.NumericLiteral{Value: 0})
+		i.SetGlobal("RLENGTH", &ast.NumericLiteral{Value: -1})
+		return &ast.NumericLiteral{Value: 0}
+	}
+	i.SetGlobal("RSTART", &ast.NumericLiteral{Value: float64(loc[0] + 1)})
+	i.SetGlobal("RLENGTH", &ast.NumericLiteral{Value: float64(loc[1] - loc[0])})
+	return &ast.NumericLiteral{Value: float64(loc[0] + 1)}
+}
+
+// regexArgument compiles an argument that is either a regex literal or a
+// string holding a dynamic regex.
+func regexArgument(arg ast.Expression, function string) *regexp.Regexp {
+	var regex string
+	switch arg.(type) {
 	case *ast.RegexLiteral:
+		regex = arg.(*ast.RegexLiteral).Value
+	case *ast.StringLiteral:
+		regex = arg.(*ast.StringLiteral).Value
+	case *ast.NumericLiteral:
+		regex = arg.String()
 	default:
-		panic("second argument to function match is not a regex")
+		panic("regex argument to function " + function + " is not a regex")
 	}
-
-	re, err := regexp.Compile(args[0].(*ast.RegexLiteral).Value)
+	re, err := regexp.Compile(regex)
 	if err != nil {
-		panic("Second argument to function match not a valid regex")
+		panic("regex argument to function " + function + " is not a valid regex")
 	}
-	loc := re.FindStringIndex(args[0].String())
-	if loc == nil {
-		return ast.NewLiteral(strconv.Itoa(-1))
+	return re
+}
+
+// unaryMathFunction builds a built-in applying fn to its single numeric argument.
+func unaryMathFunction(name string, fn func(float64) float64) func(*Interpreter, []ast.Expression) ast.Expression {
+	return func(i *Interpreter, args []ast.Expression) ast.Expression {
+		if len(args) != 1 {
+			panic("Incorrect number of arguments to function " + name)
+		}
+		return &ast.NumericLiteral{Value: fn(numericArgument(args[0], "first", name))}
+	}
+}
+
+func numericArgument(arg ast.Expression, position string, function string) float64 {
+	switch arg.(type) {
+	case *ast.StringLiteral:
+	case *ast.NumericLiteral:
+	default:
+		panic(position + " argument to function " + function + " is not a scalar.")
+	}
+	return convertLiteralForMathOp(arg)
+}
+
+var (
+	Sin  = unaryMathFunction("sin", math.Sin)
+	Cos  = unaryMathFunction("cos", math.Cos)
+	Exp  = unaryMathFunction("exp", math.Exp)
+	Log  = unaryMathFunction("log", math.Log)
+	Sqrt = unaryMathFunction("sqrt", math.Sqrt)
+	Int  = unaryMathFunction("int", math.Trunc)
+)
+
+func Atan2(i *Interpreter, args []ast.Expression) ast.Expression {
+	if len(args) != 2 {
+		panic("Incorrect number of arguments to function atan2")
+	}
+	y := numericArgument(args[0], "first", "atan2")
+	x := numericArgument(args[1], "second", "atan2")
+	return &ast.NumericLiteral{Value: math.Atan2(y, x)}
+}
+
+// Rand returns a random number in [0, 1).
+func Rand(i *Interpreter, args []ast.Expression) ast.Expression {
+	if len(args) != 0 {
+		panic("Incorrect number of arguments to function rand")
+	}
+	return &ast.NumericLiteral{Value: i.random.Float64()}
+}
+
+// Srand seeds rand with its argument, or with the time of day if called
+// without one, and returns the previous seed.
+func Srand(i *Interpreter, args []ast.Expression) ast.Expression {
+	if len(args) > 1 {
+		panic("Incorrect number of arguments to function srand")
+	}
+	previous := i.seed
+	if len(args) == 1 {
+		i.SeedRandom(int64(numericArgument(args[0], "first", "srand")))
+	} else {
+		i.SeedRandom(time.Now().Unix())
+	}
+	return &ast.NumericLiteral{Value: float64(previous)}
+}
+
+// Gensub returns target, $0 by default, with matches of a regex replaced.
+// how is "g" or "G" to replace every match, or a number n to replace only the
+// nth. In the replacement \\0 and & stand for the matched text and \\1 to
+// \\9 for capture groups. Unlike sub and gsub the target is not modified.
+func Gensub(i *Interpreter, args []ast.Expression) ast.Expression {
+	if len(args) < 3 || len(args) > 4 {
+		panic("Incorrect number of arguments to function gensub")
+	}
+	re := regexArgument(args[0], "gensub")
+	replacement := args[1].String()
+
+	global := false
+	nth := 1
+	how := args[2].String()
+	if strings.HasPrefix(how, "g") || strings.HasPrefix(how, "G") {
+		global = true
+	} else {
+		nth = max(int(convertLiteralForMathOp(args[2])), 1)
+	}
+
+	var target string
+	if len(args) == 4 {
+		target = args[3].String()
+	} else {
+		target = i.lookupField("$0").String()
+	}
+
+	var out strings.Builder
+	last := 0
+	for count, loc := range re.FindAllStringSubmatchIndex(target, -1) {
+		if !global && count+1 != nth {
+			continue
+		}
+		out.WriteString(target[last:loc[0]])
+		out.WriteString(expandBackreferences(replacement, target, loc))
+		last = loc[1]
+		if !global {
+			break
+		}
+	}
+	out.WriteString(target[last:])
+	return ast.NewLiteral(out.String())
+}
+
+func expandBackreferences(replacement string, target string, loc []int) string {
+	var out strings.Builder
+	for idx := 0; idx < len(replacement); idx++ {
+		ch := replacement[idx]
+		switch {
+		case ch == '\\' && idx+1 < len(replacement) && '0' <= replacement[idx+1] && replacement[idx+1] <= '9':
+			idx++
+			group := int(replacement[idx] - '0')
+			if 2*group+1 < len(loc) && loc[2*group] >= 0 {
+				out.WriteString(target[loc[2*group]:loc[2*group+1]])
+			}
+		case ch == '\\' && idx+1 < len(replacement) && (replacement[idx+1] == '&' || replacement[idx+1] == '\\'):
+			idx++
+			out.WriteByte(replacement[idx])
+		case ch == '&':
+			out.WriteString(target[loc[0]:loc[1]])
+		default:
+			out.WriteByte(ch)
+		}
+	}
+	return out.String()
+}
+
+// Patsplit fills an array with the parts of a string that match a regex,
+// runs of non-blank characters by default, and returns how many there are.
+// If given, a fourth array receives the separators between them, with the
+// text before the first part under index 0.
+func Patsplit(i *Interpreter, args []ast.Expression) ast.Expression {
+	if len(args) < 2 || len(args) > 4 {
+		panic("Incorrect number of arguments to function patsplit")
+	}
+	str := args[0].String()
+	re := regexp.MustCompile(`[^[:space:]]+`)
+	if len(args) >= 3 {
+		re = regexArgument(args[2], "patsplit")
+	}
+
+	array := i.arrayArgument(1)
+	array.Clear()
+	var seps *ast.AssociativeArray
+	if len(args) == 4 {
+		seps = i.arrayArgument(3)
+		seps.Clear()
+	}
+
+	locs := re.FindAllStringIndex(str, -1)
+	last := 0
+	for idx, loc := range locs {
+		array.Set(strconv.Itoa(idx+1), ast.NewLiteral(str[loc[0]:loc[1]]))
+		if seps != nil {
+			seps.Set(strconv.Itoa(idx), ast.NewLiteral(str[last:loc[0]]))
+		}
+		last = loc[1]
+	}
+	if seps != nil {
+		seps.Set(strconv.Itoa(len(locs)), ast.NewLiteral(str[last:]))
+		i.checkArraySize(seps)
+	}
+	i.checkArraySize(array)
+	return &ast.NumericLiteral{Value: float64(len(locs))}
+}
+
+// compareValues orders values the way gawk sorts them by default: numbers
+// first in numeric order, then strings in byte order.
+func compareValues(a ast.Expression, b ast.Expression) int {
+	an, aIsNumber := a.(*ast.NumericLiteral)
+	bn, bIsNumber := b.(*ast.NumericLiteral)
+	switch {
+	case aIsNumber && bIsNumber:
+		return cmp.Compare(an.Value, bn.Value)
+	case aIsNumber:
+		return -1
+	case bIsNumber:
+		return 1
+	default:
+		return strings.Compare(a.String(), b.String())
+	}
+}
+
+// Asort sorts the values of an array and stores them under the indices 1 to
+// n, in place or in a second array if one is given, and returns n. An
+// ordering such as "@val_str_desc" or a comparison function may be named as
+// for PROCINFO["sorted_in"].
+func Asort(i *Interpreter, args []ast.Expression) ast.Expression {
+	return sortArray(i, args, "asort", "@val_type_asc", func(key string, value ast.Expression) ast.Expression { return value })
+}
+
+// Asorti sorts the indices of an array and stores them as values under the
+// indices 1 to n, in place or in a second array if one is given, and returns n.
+func Asorti(i *Interpreter, args []ast.Expression) ast.Expression {
+	return sortArray(i, args, "asorti", "@ind_str_asc", func(key string, value ast.Expression) ast.Expression { return ast.NewLiteral(key) })
+}
+
+func sortArray(i *Interpreter, args []ast.Expression, function string, how string, item func(string, ast.Expression) ast.Expression) ast.Expression {
+	if len(args) < 1 || len(args) > 3 {
+		panic("Incorrect number of arguments to function " + function)
+	}
+	source := i.arrayArgument(0)
+	dest := source
+	if len(args) >= 2 {
+		dest = i.arrayArgument(1)
+	}
+	if len(args) == 3 {
+		how = args[2].String()
+	}
+
+	var items []ast.Expression
+	for _, key := range i.sortKeys(source, how) {
+		items = append(items, item(key, source.Array[key]))
+	}
+
+	dest.Clear()
+	for idx, value := range items {
+		dest.Set(strconv.Itoa(idx+1), value)
+	}
+	i.checkArraySize(dest)
+	return &ast.NumericLiteral{Value: float64(len(items))}
+}
+
+// Systime returns the current time in seconds since the epoch.
+func Systime(i *Interpreter, args []ast.Expression) ast.Expression {
+	if len(args) != 0 {
+		panic("Incorrect number of arguments to function systime")
+	}
+	return &ast.NumericLiteral{Value: float64(time.Now().Unix())}
+}
+
+// Mktime converts a "YYYY MM DD HH MM SS" date specification in local time,
+// or UTC if the second argument is true, to seconds since the epoch. It
+// returns -1 if the specification is malformed.
+func Mktime(i *Interpreter, args []ast.Expression) ast.Expression {
+	if len(args) < 1 || len(args) > 2 {
+		panic("Incorrect number of arguments to function mktime")
+	}
+	fields := strings.Fields(args[0].String())
+	if len(fields) < 6 || len(fields) > 7 {
+		return &ast.NumericLiteral{Value: -1}
+	}
+	var parts [6]int
+	for idx := range parts {
+		val, err := strconv.Atoi(fields[idx])
+		if err != nil {
+			return &ast.NumericLiteral{Value: -1}
+		}
+		parts[idx] = val
+	}
+	location := time.Local
+	if len(args) == 2 && ExpressionToBool(args[1]) {
+		location = time.UTC
+	}
+	date := time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], 0, location)
+	return &ast.NumericLiteral{Value: float64(date.Unix())}
+}
+
+// Strftime formats a timestamp, the current time by default, using the
+// conversions of C's strftime. The time is local unless the third argument
+// is true.
+func Strftime(i *Interpreter, args []ast.Expression) ast.Expression {
+	if len(args) > 3 {
+		panic("Incorrect number of arguments to function strftime")
+	}
+	format := "%a %b %e %H:%M:%S %Z %Y"
+	if len(args) >= 1 {
+		format = args[0].String()
+	}
+	timestamp := time.Now()
+	if len(args) >= 2 {
+		timestamp = time.Unix(int64(convertLiteralForMathOp(args[1])), 0)
+	}
+	if len(args) == 3 && ExpressionToBool(args[2]) {
+		timestamp = timestamp.UTC()
+	} else {
+		timestamp = timestamp.Local()
+	}
+	return &ast.StringLiteral{Value: formatTime(format, timestamp)}
+}
+
+func formatTime(format string, t time.Time) string {
+	var out strings.Builder
+	for idx := 0; idx < len(format); idx++ {
+		if format[idx] != '%' || idx+1 == len(format) {
+			out.WriteByte(format[idx])
+			continue
+		}
+		idx++
+		switch format[idx] {
+		case 'a':
+			out.WriteString(t.Format("Mon"))
+		case 'A':
+			out.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			out.WriteString(t.Format("Jan"))
+		case 'B':
+			out.WriteString(t.Format("January"))
+		case 'c':
+			out.WriteString(formatTime("%a %b %e %H:%M:%S %Y", t))
+		case 'C':
+			fmt.Fprintf(&out, "%02d", t.Year()/100)
+		case 'd':
+			fmt.Fprintf(&out, "%02d", t.Day())
+		case 'D', 'x':
+			out.WriteString(formatTime("%m/%d/%y", t))
+		case 'e':
+			fmt.Fprintf(&out, "%2d", t.Day())
+		case 'F':
+			out.WriteString(formatTime("%Y-%m-%d", t))
+		case 'g':
+			year, _ := t.ISOWeek()
+			fmt.Fprintf(&out, "%02d", year%100)
+		case 'G':
+			year, _ := t.ISOWeek()
+			fmt.Fprintf(&out, "%d", year)
+		case 'H':
+			fmt.Fprintf(&out, "%02d", t.Hour())
+		case 'I':
+			fmt.Fprintf(&out, "%02d", (t.Hour()+11)%12+1)
+		case 'j':
+			fmt.Fprintf(&out, "%03d", t.YearDay())
+		case 'k':
+			fmt.Fprintf(&out, "%2d", t.Hour())
+		case 'l':
+			fmt.Fprintf(&out, "%2d", (t.Hour()+11)%12+1)
+		case 'm':
+			fmt.Fprintf(&out, "%02d", int(t.Month()))
+		case 'M':
+			fmt.Fprintf(&out, "%02d", t.Minute())
+		case 'n':
+			out.WriteByte('\n')
+		case 'p':
+			out.WriteString(t.Format("PM"))
+		case 'r':
+			out.WriteString(formatTime("%I:%M:%S %p", t))
+		case 'R':
+			out.WriteString(formatTime("%H:%M", t))
+		case 's':
+			fmt.Fprintf(&out, "%d", t.Unix())
+		case 'S':
+			fmt.Fprintf(&out, "%02d", t.Second())
+		case 't':
+			out.WriteByte('\t')
+		case 'T', 'X':
+			out.WriteString(formatTime("%H:%M:%S", t))
+		case 'u':
+			fmt.Fprintf(&out, "%d", (int(t.Weekday())+6)%7+1)
+		case 'U':
+			fmt.Fprintf(&out, "%02d", (t.YearDay()+6-int(t.Weekday()))/7)
+		case 'V':
+			_, week := t.ISOWeek()
+			fmt.Fprintf(&out, "%02d", week)
+		case 'w':
+			fmt.Fprintf(&out, "%d", int(t.Weekday()))
+		case 'W':
+			fmt.Fprintf(&out, "%02d", (t.YearDay()+6-(int(t.Weekday())+6)%7)/7)
+		case 'y':
+			fmt.Fprintf(&out, "%02d", t.Year()%100)
+		case 'Y':
+			fmt.Fprintf(&out, "%d", t.Year())
+		case 'z':
+			out.WriteString(t.Format("-0700"))
+		case 'Z':
+			out.WriteString(t.Format("MST"))
+		case '%':
+			out.WriteByte('%')
+		default:
+			out.WriteByte('%')
+			out.WriteByte(format[idx])
+		}
 	}
-	return ast.NewLiteral(strconv.Itoa(loc[0]))
+	return out.String()
 }
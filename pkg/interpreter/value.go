@@ -0,0 +1,137 @@
+package interpreter
+
+import (
+	"strconv"
+
+	"github.com/ahalbert/strawk/pkg/ast"
+)
+
+// valueKind says which field of a value holds it.
+type valueKind uint8
+
+const (
+	unsetKind  valueKind = iota // a global never assigned, which reads as ""
+	numberKind                  // num
+	stringKind                  // str
+	otherKind                   // expr, an array or a regex
+)
+
+// value is what the VM computes with. Numbers and strings are held inline,
+// so that arithmetic, comparisons and assignments do not allocate; arrays
+// and regexes keep the expression they are. A string read from the input
+// that looks like a number is a number, as ast.NewLiteral makes it.
+type value struct {
+	kind valueKind
+	num  float64
+	str  string
+	expr ast.Expression
+}
+
+var (
+	emptyValue = stringValue("")
+	trueValue  = stringValue("1")
+	falseValue = stringValue("0")
+)
+
+func numberValue(f float64) value { return value{kind: numberKind, num: f} }
+
+func stringValue(s string) value { return value{kind: stringKind, str: s} }
+
+// literalValue is a string that holds a number if it looks like one, as
+// ast.NewLiteral makes it.
+func literalValue(s string) value {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return numberValue(f)
+	}
+	return stringValue(s)
+}
+
+// fromExpression unpacks an expression, nil for an unset value.
+func fromExpression(expr ast.Expression) value {
+	switch expr := expr.(type) {
+	case nil:
+		return value{}
+	case *ast.NumericLiteral:
+		return numberValue(expr.Value)
+	case *ast.StringLiteral:
+		return stringValue(expr.Value)
+	default:
+		return value{kind: otherKind, expr: expr}
+	}
+}
+
+// expression packs a value for arrays, fields and built-ins, which hold
+// expressions. An unset value is nil.
+func (v value) expression() ast.Expression {
+	switch v.kind {
+	case numberKind:
+		return &ast.NumericLiteral{Value: v.num}
+	case stringKind:
+		return &ast.StringLiteral{Value: v.str}
+	case otherKind:
+		return v.expr
+	default:
+		return nil
+	}
+}
+
+func (v value) isUnset() bool { return v.kind == unsetKind }
+
+// array returns the array a value holds, or nil if it is not one.
+func (v value) array() *ast.AssociativeArray {
+	array, _ := v.expr.(*ast.AssociativeArray)
+	return array
+}
+
+// isEmptyScalar reports whether a value is unset or the empty string, which
+// can still become an array.
+func (v value) isEmptyScalar() bool {
+	return v.kind == unsetKind || v.kind == stringKind && v.str == ""
+}
+
+func (v value) String() string {
+	switch v.kind {
+	case numberKind:
+		return ast.FormatNumber(v.num)
+	case otherKind:
+		return v.expr.String()
+	default:
+		return v.str
+	}
+}
+
+// number converts a scalar the way arithmetic does.
+func (v value) number() float64 {
+	switch v.kind {
+	case numberKind:
+		return v.num
+	case otherKind:
+		panic("error in math")
+	default:
+		return StringToNumber(v.str)
+	}
+}
+
+// text converts a scalar the way concatenation and comparisons do.
+func (v value) text() string {
+	if v.kind == otherKind {
+		panic("error in literal to string conversion")
+	}
+	return v.String()
+}
+
+// bool reports whether a value is true, as ExpressionToBool does: anything
+// but the number 0, the string "0" and the empty string.
+func (v value) bool() bool {
+	switch v.kind {
+	case numberKind:
+		return v.num != 0
+	case otherKind:
+		if v.array() != nil {
+			panic("Got Array in Scalar Context!")
+		}
+		panic("Expected Bool expression!!!")
+	default:
+		return v.str != "" && v.str != "0"
+	}
+}
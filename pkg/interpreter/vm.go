@@ -0,0 +1,579 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ahalbert/strawk/pkg/ast"
+)
+
+// emptyString is the value of a field no match has set.
+var emptyString = &ast.StringLiteral{Value: ""}
+
+// zeroField is the lvalue of $0, which print, sub and getline use by default.
+var zeroField = &lvalue{kind: field, display: "$0"}
+
+// location is an lvalue whose subscripts or field name have been evaluated.
+type location struct {
+	lv    *lvalue
+	slot  *value                    // global or parameter; nil if the variable is a $ name
+	vars  map[string]ast.Expression // scope a $ name lives in
+	keys  []string
+	field string
+}
+
+// iterator walks the keys of an array for a for-in loop.
+type iterator struct {
+	keys []string
+	pos  int
+}
+
+func (i *Interpreter) push(v value) {
+	i.stack = append(i.stack, v)
+}
+
+func (i *Interpreter) pop() value {
+	v := i.stack[len(i.stack)-1]
+	i.stack = i.stack[:len(i.stack)-1]
+	return v
+}
+
+// operands pops the right operand of a binary operator and returns it with
+// the left one, which is left on the stack for the result to replace.
+func (i *Interpreter) operands() (*value, value) {
+	top := len(i.stack) - 1
+	right := i.stack[top]
+	i.stack = i.stack[:top]
+	return &i.stack[top-1], right
+}
+
+// popN removes the top n values, returning them bottom first. The slice is
+// only valid until the next push.
+func (i *Interpreter) popN(n int) []value {
+	values := i.stack[len(i.stack)-n:]
+	i.stack = i.stack[:len(i.stack)-n]
+	return values
+}
+
+// runBlock runs a BEGIN or END block or a rule, recording how it stopped. A
+// Go runtime error is a bug in the interpreter rather than in the program,
+// so it is not reported as one.
+func (i *Interpreter) runBlock(code []instruction) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch r := r.(type) {
+			case runtime.Error:
+				panic(r)
+			case error:
+				i.WasFatalErrorHit = true
+				i.err = r
+			case string:
+				if r == "next" {
+					i.WasNextStatementHit = true
+					return
+				}
+				i.WasFatalErrorHit = true
+				i.err = &RuntimeError{Line: i.currentLine(), InputOffset: i.InputPostion, Err: errors.New(r)}
+			default:
+				panic(r)
+			}
+		}
+	}()
+	i.stack = i.stack[:0]
+	i.locals = nil
+	i.references = nil
+	i.callDepth = 0
+	i.checkCancelled()
+	i.execute(code)
+}
+
+// execute runs compiled code until it returns or runs off its end.
+func (i *Interpreter) execute(code []instruction) value {
+	base := len(i.stack)
+	var iterators []*iterator
+	for pc := 0; pc < len(code); pc++ {
+		ins := code[pc]
+		switch ins.op {
+		case opLine:
+			if ins.a > 0 {
+				i.line = ins.a
+			}
+			i.step()
+		case opConst:
+			i.push(i.constants[ins.a])
+		case opPop:
+			i.pop()
+		case opDupN:
+			i.stack = append(i.stack, i.stack[len(i.stack)-ins.a:]...)
+		case opLoadGlobal:
+			v := i.globals[ins.a]
+			if v.isUnset() {
+				v = emptyValue
+			}
+			i.push(v)
+		case opLoadLocal:
+			i.push(i.locals[ins.a])
+		case opStoreGlobal:
+			v := i.stack[len(i.stack)-1]
+			i.checkStringLength(v)
+			i.globals[ins.a] = v
+			if ins.b == 0 {
+				i.pop()
+			}
+		case opStoreLocal:
+			v := i.stack[len(i.stack)-1]
+			i.checkStringLength(v)
+			i.locals[ins.a] = v
+			if ins.b == 0 {
+				i.pop()
+			}
+		case opLoad:
+			loc := i.locate(ins.a)
+			i.push(i.load(&loc))
+		case opStore:
+			v := i.pop()
+			loc := i.locate(ins.a)
+			i.store(&loc, v)
+			if ins.b != 0 {
+				i.push(v)
+			}
+		case opIncrement, opPostIncrement:
+			loc := i.locate(ins.a)
+			old := i.load(&loc)
+			v := numberValue(old.number() + float64(ins.b))
+			i.store(&loc, v)
+			if ins.op == opIncrement {
+				i.push(v)
+			} else {
+				i.push(stringValue(old.String()))
+			}
+		case opFieldName:
+			i.push(stringValue(i.fieldName(i.pop(), ins.a)))
+		case opJoin:
+			var subscripts []string
+			for _, v := range i.popN(ins.a) {
+				subscripts = append(subscripts, v.String())
+			}
+			i.push(stringValue(i.joinSubscripts(subscripts...)))
+		case opConcat:
+			left, right := i.operands()
+			*left = i.doConcatenate(*left, right)
+			i.checkStringLength(*left)
+		case opAdd:
+			left, right := i.operands()
+			*left = i.doAdd(*left, right)
+		case opSubtract:
+			left, right := i.operands()
+			*left = i.doMinus(*left, right)
+		case opMultiply:
+			left, right := i.operands()
+			*left = i.doMultiply(*left, right)
+		case opDivide:
+			left, right := i.operands()
+			*left = i.doDivide(*left, right)
+		case opModulo:
+			left, right := i.operands()
+			*left = i.doModulus(*left, right)
+		case opPower:
+			left, right := i.operands()
+			*left = i.doExponentiation(*left, right)
+		case opEqual:
+			left, right := i.operands()
+			*left = i.doEquality(*left, right)
+		case opNotEqual:
+			left, right := i.operands()
+			*left = invertBool(i.doEquality(*left, right))
+		case opLess:
+			left, right := i.operands()
+			*left = i.doLessThan(*left, right)
+		case opLessEqual:
+			left, right := i.operands()
+			*left = i.doLessThanEqualTo(*left, right)
+		case opGreater:
+			left, right := i.operands()
+			*left = i.doGreaterThan(*left, right)
+		case opGreaterEqual:
+			left, right := i.operands()
+			*left = i.doGreaterThanEqualTo(*left, right)
+		case opMatch:
+			right := i.pop()
+			left := i.pop()
+			switch ins.b {
+			case 0:
+				i.push(i.doRegexMatch(left, right, false))
+			case 1:
+				i.push(invertBool(i.doRegexMatch(left, right, false)))
+			default:
+				i.push(i.doRegexMatch(left, right, true))
+			}
+		case opIn:
+			left, right := i.operands()
+			*left = i.doArrayMembership(*left, right)
+		case opNot:
+			i.push(invertBool(i.pop()))
+		case opNegate:
+			i.push(negate(i.pop()))
+		case opToNumber:
+			i.push(numberValue(i.pop().number()))
+		case opToBool:
+			i.push(boolValue(i.pop().bool()))
+		case opJump:
+			if ins.a <= pc {
+				i.step()
+			}
+			pc = ins.a - 1
+		case opJumpIfFalse:
+			if !i.pop().bool() {
+				pc = ins.a - 1
+			}
+		case opJumpIfTrue:
+			if i.pop().bool() {
+				if ins.a <= pc {
+					i.step()
+				}
+				pc = ins.a - 1
+			}
+		case opPushScope:
+			i.Stack = append(i.Stack, CallStackEntry{LocalVariables: i.mostRecentRegexCaptureGroups, Match: i.mostRecentRegexMatch})
+		case opPopScope:
+			i.Stack = i.Stack[:len(i.Stack)-1]
+		case opForIn:
+			iterators = append(iterators, i.iterate(i.pop()))
+		case opForInNext:
+			it := iterators[len(iterators)-1]
+			if it.pos >= len(it.keys) {
+				iterators = iterators[:len(iterators)-1]
+				pc = ins.a - 1
+				continue
+			}
+			i.push(stringValue(it.keys[it.pos]))
+			it.pos++
+		case opForInEnd:
+			iterators = iterators[:len(iterators)-1]
+		case opDelete:
+			i.delete(ins.a)
+		case opCall:
+			i.push(i.call(&i.code.calls[ins.a]))
+		case opReturn:
+			v := i.pop()
+			i.stack = i.stack[:base]
+			return v
+		case opNext:
+			panic("next")
+		case opPrint:
+			i.print(ins.a, ins.b)
+		case opGetline:
+			var target *location
+			if ins.a >= 0 {
+				loc := i.locate(ins.a)
+				target = &loc
+			}
+			name := i.pop().String()
+			i.push(fromExpression(i.getline(name, ins.b != 0, target)))
+		case opRuntimeError:
+			panic(i.code.constants[ins.a].String())
+		default:
+			panic("Unknown instruction")
+		}
+	}
+	i.stack = i.stack[:base]
+	return emptyValue
+}
+
+// locate pops the operands of lvalue idx and finds what it refers to.
+func (i *Interpreter) locate(idx int) location {
+	lv := &i.code.lvalues[idx]
+	loc := location{lv: lv}
+	switch lv.kind {
+	case field:
+		loc.field = i.pop().String()
+		return loc
+	case arrayElement:
+		for _, key := range i.popN(lv.levels) {
+			loc.keys = append(loc.keys, key.String())
+		}
+	}
+	switch lv.scope {
+	case globalVariable:
+		loc.slot = &i.globals[lv.slot]
+	case localVariable:
+		loc.slot = &i.locals[lv.slot]
+	default:
+		loc.vars = i.variables(lv.name)
+	}
+	return loc
+}
+
+// get returns the variable a location is in, or an element's array
+// variable, which is unset if it has not been assigned.
+func (loc *location) get() value {
+	if loc.slot != nil {
+		return *loc.slot
+	}
+	return fromExpression(loc.vars[loc.lv.name])
+}
+
+func (loc *location) set(v value) {
+	if loc.slot != nil {
+		*loc.slot = v
+	} else {
+		loc.vars[loc.lv.name] = v.expression()
+	}
+}
+
+func (i *Interpreter) load(loc *location) value {
+	var v value
+	switch loc.lv.kind {
+	case field:
+		return fromExpression(i.lookupField(loc.field))
+	case arrayElement:
+		if array := i.elementArray(loc, false); array != nil {
+			v = fromExpression(array.Array[loc.keys[len(loc.keys)-1]])
+		}
+	default:
+		v = loc.get()
+	}
+	if v.isUnset() {
+		return emptyValue
+	}
+	return v
+}
+
+func (i *Interpreter) store(loc *location, v value) {
+	switch loc.lv.kind {
+	case field:
+		i.setField(loc.field, v.expression())
+	case arrayElement:
+		i.checkStringLength(v)
+		array := i.elementArray(loc, true)
+		key := loc.keys[len(loc.keys)-1]
+		if _, ok := array.Array[key].(*ast.AssociativeArray); ok {
+			panic("attempt to use array " + loc.lv.display + " in a scalar context")
+		}
+		array.Set(key, v.expression())
+		i.checkArraySize(array)
+	default:
+		i.checkStringLength(v)
+		loc.set(v)
+	}
+}
+
+// elementArray returns the array that holds an element: the array variable
+// for a[i], or the subarray a[i] for a[i][j]. Missing arrays are created
+// when create is set and reported as nil otherwise.
+func (i *Interpreter) elementArray(loc *location, create bool) *ast.AssociativeArray {
+	v := loc.get()
+	array := v.array()
+	if array == nil && !v.isEmptyScalar() && !create {
+		panic("attempt to address scalar with index")
+	}
+	if array == nil {
+		if !create {
+			return nil
+		}
+		array = ast.NewAssociativeArray()
+		i.bindArray(loc, array)
+	}
+
+	for level, key := range loc.keys[:len(loc.keys)-1] {
+		switch val := array.Array[key].(type) {
+		case *ast.AssociativeArray:
+			array = val
+		case nil:
+			if !create {
+				return nil
+			}
+			subarray := ast.NewAssociativeArray()
+			array.Set(key, subarray)
+			array = subarray
+		default:
+			panic("attempt to use scalar " + loc.lv.path[level] + " as array")
+		}
+	}
+	return array
+}
+
+// bindArray stores a newly created array in a variable. If the variable is a
+// parameter that was passed an unset global, the array is stored in the
+// global too, so that arrays a function creates reach its caller.
+func (i *Interpreter) bindArray(loc *location, array *ast.AssociativeArray) {
+	loc.set(value{kind: otherKind, expr: array})
+	if loc.lv.scope != localVariable {
+		return
+	}
+	if slot, ok := i.references[loc.lv.slot]; ok {
+		i.globals[slot] = value{kind: otherKind, expr: array}
+		delete(i.references, loc.lv.slot)
+	}
+}
+
+// fieldName turns the operand of $ into the name its capture group is
+// stored under. name is the constant holding the operand's variable name,
+// if it is a variable, since $name refers to a named group when there is one.
+func (i *Interpreter) fieldName(index value, name int) string {
+	if name >= 0 {
+		ident := i.code.constants[name].String()
+		if i.isNamedCaptureGroup(ident) {
+			return "$" + ident
+		}
+	}
+	idx := index.number()
+	if idx < 0 {
+		panic(fmt.Sprintf("attempt to access field %d", int(idx)))
+	}
+	return "$" + strconv.Itoa(int(idx))
+}
+
+func (i *Interpreter) delete(idx int) {
+	lv := &i.code.lvalues[idx]
+	loc := i.locate(idx)
+	if lv.kind == arrayElement {
+		if array := i.elementArray(&loc, false); array != nil {
+			array.Delete(loc.keys[len(loc.keys)-1])
+		}
+		return
+	}
+	v := loc.get()
+	if array := v.array(); array != nil {
+		array.Clear()
+	} else if !v.isEmptyScalar() {
+		panic("Attempt to delete on scalar variable")
+	}
+}
+
+func (i *Interpreter) iterate(v value) *iterator {
+	if array := v.array(); array != nil {
+		return &iterator{keys: i.traversalOrder(array)}
+	}
+	if v.kind == stringKind && v.str == "" {
+		return &iterator{}
+	}
+	panic("Attempt to foreach on scalar variable")
+}
+
+func (i *Interpreter) print(count int, redirect int) {
+	out := i.Output
+	if redirect >= 0 {
+		destination := i.pop().String()
+		out = i.outputFor(i.code.constants[redirect].String(), destination)
+	}
+	var line strings.Builder
+	for idx, v := range i.popN(count) {
+		if idx > 0 {
+			line.WriteByte(' ')
+		}
+		line.WriteString(v.String())
+	}
+	line.WriteByte('\n')
+	_, err := io.WriteString(out, line.String())
+	if errors.Is(err, ErrLimitExceeded) {
+		i.exceeded("output")
+	}
+}
+
+// call pops the arguments of a call and calls the function.
+func (i *Interpreter) call(site *callSite) value {
+	args := slices.Clone(i.popN(site.width))
+	if site.function >= 0 {
+		var references map[int]int
+		for idx, lv := range site.args {
+			if lv < 0 {
+				continue
+			}
+			slot := i.code.lvalues[lv].slot
+			if i.globals[slot].isUnset() {
+				if references == nil {
+					references = make(map[int]int)
+				}
+				references[idx] = slot
+			}
+		}
+		return i.callFunction(i.code.functions[site.function], args, references)
+	}
+
+	function, ok := i.StdLibFunctions[site.name]
+	if !ok {
+		panic("attempt to call non-existent function")
+	}
+	values := make([]ast.Expression, len(site.args))
+	locations := make([]*location, len(site.args))
+	for idx := len(site.args) - 1; idx >= 0; idx-- {
+		lv := site.args[idx]
+		if lv < 0 {
+			values[idx] = args[len(args)-1].expression()
+			args = args[:len(args)-1]
+			continue
+		}
+		operands := i.code.lvalues[lv].operands()
+		i.stack = append(i.stack, args[len(args)-operands:]...)
+		args = args[:len(args)-operands]
+		loc := i.locate(lv)
+		locations[idx] = &loc
+		values[idx] = i.load(&loc).expression()
+	}
+
+	callerArguments := i.callArguments
+	i.callArguments = locations
+	defer func() { i.callArguments = callerArguments }()
+	return fromExpression(function(i, values))
+}
+
+// callFunction runs a user-defined function with its parameters bound to
+// already evaluated arguments and returns the value it returns.
+func (i *Interpreter) callFunction(fn *function, args []value, references map[int]int) value {
+	i.step()
+	i.checkCancelled()
+	locals := make([]value, fn.params)
+	copy(locals, args)
+	for idx := len(args); idx < len(locals); idx++ {
+		locals[idx] = emptyValue
+	}
+
+	callerLocals, callerReferences, depth := i.locals, i.references, len(i.Stack)
+	i.locals, i.references = locals, references
+	i.callDepth++
+	i.checkCallDepth()
+	result := i.execute(fn.code)
+	i.callDepth--
+	i.locals, i.references, i.Stack = callerLocals, callerReferences, i.Stack[:depth]
+	return result
+}
+
+// argumentLocation returns what argument idx of the built-in being called
+// refers to, or nil if it is not a variable, element or field.
+func (i *Interpreter) argumentLocation(idx int) *location {
+	if idx >= len(i.callArguments) {
+		return nil
+	}
+	return i.callArguments[idx]
+}
+
+// arrayArgument returns the array passed as argument idx of the built-in being
+// called, creating it if the variable does not exist yet.
+func (i *Interpreter) arrayArgument(idx int) *ast.AssociativeArray {
+	loc := i.argumentLocation(idx)
+	if loc == nil || loc.lv.kind == field {
+		panic("argument " + strconv.Itoa(idx+1) + " is not an array")
+	}
+	if loc.lv.kind == arrayElement {
+		// a[i] is an array argument when it is itself a subarray
+		subarray := *loc
+		subarray.keys = append(slices.Clip(loc.keys), "")
+		return i.elementArray(&subarray, true)
+	}
+	v := loc.get()
+	if array := v.array(); array != nil {
+		return array
+	}
+	if !v.isEmptyScalar() {
+		panic("attempt to use scalar " + loc.lv.display + " as array")
+	}
+	array := ast.NewAssociativeArray()
+	i.bindArray(loc, array)
+	return array
+}
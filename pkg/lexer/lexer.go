@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"slices"
+	"strings"
 
 	"github.com/ahalbert/strawk/pkg/token"
 )
@@ -11,63 +12,72 @@ type Lexer struct {
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
 	ch           byte // current char under examination
-	lineNum      int
-	linePosition int
+	lineNum      int  // line of ch; a newline belongs to the line it ends
+	linePosition int  // column of ch, counting from 1
+	tokenLine    int  // where the token being read starts
+	tokenColumn  int
+	tokenOffset  int
+	lastType     token.TokenType // the type of the last token other than trivia
+	regexEnd     int             // offset of the / closing the regex being read, if any
 
 	ExpectRegex bool
+	// Trivia makes NextToken return comments and whitespace as COMMENT and
+	// WHITESPACE tokens instead of skipping them, so that the tokens cover
+	// the whole input.
+	Trivia bool
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input, lineNum: 1, linePosition: 1, ExpectRegex: false}
+	l := &Lexer{input: input, lineNum: 1, ExpectRegex: false}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) newToken(tokenType token.TokenType, s string) token.Token {
-	return token.Token{Type: tokenType, Literal: s, LineNum: l.lineNum, Position: l.linePosition}
+	return token.Token{Type: tokenType, Literal: s, LineNum: l.tokenLine, Position: l.tokenColumn, Offset: l.tokenOffset}
+}
+
+// startToken marks the current character as the start of the next token.
+func (l *Lexer) startToken() {
+	l.tokenLine, l.tokenColumn, l.tokenOffset = l.lineNum, l.linePosition, l.position
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.lineNum++
+		l.linePosition = 0
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
 		l.ch = l.input[l.readPosition]
-
-		if l.ch == '\n' {
-			l.lineNum++
-			l.linePosition = 1
-		}
 	}
 	l.linePosition++
 	l.position = l.readPosition
 	l.readPosition += 1
 }
 
+// unreadChar steps back to the previous character.
+func (l *Lexer) unreadChar() {
+	l.readPosition -= 1
+	l.position -= 1
+	l.ch = l.input[l.position]
+	if l.ch == '\n' {
+		l.lineNum--
+		l.linePosition = l.position - strings.LastIndexByte(l.input[:l.position], '\n')
+	} else {
+		l.linePosition -= 1
+	}
+}
+
 func (l *Lexer) BacktrackToChar(target byte) {
 	if l.readPosition == 0 {
 		return
 	}
 
-	l.readPosition -= 1
-	l.position -= 1
-	l.linePosition -= 1
-	l.ch = l.input[l.position]
-
+	l.unreadChar()
 	for l.ch != target {
-		if l.ch == '\n' {
-			l.lineNum--
-			tempPos := l.readPosition - 1
-			lineCharCount := 0
-			for tempPos > 0 && l.input[tempPos] != '\n' {
-				lineCharCount++
-				tempPos--
-			}
-			l.linePosition = lineCharCount
-		}
-		l.readPosition -= 1
-		l.position -= 1
-		l.linePosition -= 1
-		l.ch = l.input[l.position]
+		l.unreadChar()
 	}
 }
 
@@ -99,6 +109,39 @@ func (l *Lexer) readWhileChar(chars ...byte) string {
 	return l.input[position:l.position]
 }
 
+var escapes = map[byte]byte{
+	'"':  '"',
+	'\\': '\\',
+	'/':  '/',
+	'a':  '\a',
+	'b':  '\b',
+	'f':  '\f',
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+	'v':  '\v',
+}
+
+// readEscapedString reads a double quoted string, translating escape
+// sequences as awk does. Unknown escapes are kept as written.
+func (l *Lexer) readEscapedString() string {
+	var out []byte
+	for l.ch != '"' && l.ch != 0 {
+		if l.ch == '\\' && l.readPosition < len(l.input) {
+			l.readChar()
+			if escaped, ok := escapes[l.ch]; ok {
+				out = append(out, escaped)
+			} else {
+				out = append(out, '\\', l.ch)
+			}
+		} else {
+			out = append(out, l.ch)
+		}
+		l.readChar()
+	}
+	return string(out)
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 	for isLetter(l.ch) && l.ch != 0 {
@@ -108,7 +151,7 @@ func (l *Lexer) readIdentifier() string {
 }
 
 func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' || ch == '_' || ch == '$' || ch == '@'
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' || ch == '_' || ch == '@'
 }
 
 func (l *Lexer) readNumeric() string {
@@ -123,15 +166,47 @@ func isDigit(ch byte) bool {
 	return ch == '.' || '0' <= ch && ch <= '9'
 }
 
+// operandEnds are the tokens after which a / divides rather than starts a
+// regex.
+var operandEnds = []token.TokenType{
+	token.IDENT,
+	token.NUMBER,
+	token.STRING,
+	token.REGEX,
+	token.RPAREN,
+	token.RBRACKET,
+	token.INCREMENT,
+	token.DECREMENT,
+}
+
 func (l *Lexer) NextToken() token.Token {
+	tok := l.nextToken()
+	if tok.Type != token.WHITESPACE && tok.Type != token.COMMENT {
+		l.lastType = tok.Type
+	}
+	return tok
+}
+
+func (l *Lexer) nextToken() token.Token {
 	var tok token.Token
 
 	if l.ExpectRegex {
 		l.readChar()
-		return l.newToken(token.REGEX, l.readUntilChar('/'))
+		l.startToken()
+		regex := l.readUntilChar('/', '\n')
+		if l.ch != '/' {
+			// a regex ends on the line it starts on
+			return l.newToken(token.ILLEGAL, regex)
+		}
+		return l.newToken(token.REGEX, regex)
 	}
 
-	l.skipWhitespace()
+	if !l.Trivia {
+		l.skipWhitespace()
+	} else if tok, ok := l.readTrivia(); ok {
+		return tok
+	}
+	l.startToken()
 
 	switch l.ch {
 	case '/':
@@ -141,12 +216,15 @@ func (l *Lexer) NextToken() token.Token {
 			tok = l.newToken(token.ASSIGNDIVIDE, "/=")
 		} else {
 			tok = l.newToken(token.SLASH, "/")
+			if !slices.Contains(operandEnds, l.lastType) {
+				l.openRegex()
+			}
 		}
 	case '\\':
 		tok = l.newToken(token.ESCAPED_SLASH, "\\")
 	case '"':
 		l.readChar()
-		tok = l.newToken(token.STRING, l.readUntilChar('"'))
+		tok = l.newToken(token.STRING, l.readEscapedString())
 	case '\'':
 		l.readChar()
 		tok = l.newToken(token.STRING, l.readUntilChar('\''))
@@ -157,7 +235,7 @@ func (l *Lexer) NextToken() token.Token {
 		lookahead := l.peek(1)
 		if lookahead == "=" {
 			l.readChar()
-			tok = l.newToken(token.ASSIGNPLUS, "-=")
+			tok = l.newToken(token.ASSIGNMINUS, "-=")
 		} else if lookahead == "-" {
 			l.readChar()
 			tok = l.newToken(token.DECREMENT, "--")
@@ -179,6 +257,8 @@ func (l *Lexer) NextToken() token.Token {
 		tok = l.newToken(token.LBRACKET, "[")
 	case ']':
 		tok = l.newToken(token.RBRACKET, "]")
+	case '$':
+		tok = l.newToken(token.DOLLAR, "$")
 	case '(':
 		tok = l.newToken(token.LPAREN, "(")
 	case ')':
@@ -255,7 +335,7 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			tok = l.newToken(token.OR, "||")
 		} else {
-			tok = l.newToken(token.ILLEGAL, string(l.ch))
+			tok = l.newToken(token.PIPE, "|")
 		}
 	case '<':
 		lookahead := l.peek(1)
@@ -270,6 +350,9 @@ func (l *Lexer) NextToken() token.Token {
 		if lookahead == "=" {
 			l.readChar()
 			tok = l.newToken(token.GTEQ, ">=")
+		} else if lookahead == ">" {
+			l.readChar()
+			tok = l.newToken(token.APPEND, ">>")
 		} else {
 			tok = l.newToken(token.GT, ">")
 		}
@@ -283,6 +366,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.LookupIdent(tok.Literal)
 		} else {
 			tok = l.newToken(token.ILLEGAL, string(l.ch))
+			l.readChar()
 		}
 		return tok
 	}
@@ -291,34 +375,44 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
-func (l *Lexer) isInsideRegex() bool {
-	var next bool
-	var prev bool
-	pos := l.readPosition
-	for !slices.Contains([]byte{'\n', '/'}, l.input[pos]) && pos < len(l.input) {
-		pos += 1
-	}
-	if l.input[pos] == '/' {
-		next = true
-	}
-	pos = l.readPosition
-	for !slices.Contains([]byte{'\n', '/'}, l.input[pos]) && pos > 0 {
-		pos -= 1
+// openRegex records where the regex starting at the current / ends: at the
+// next / on the line, where the parser reads it to.
+func (l *Lexer) openRegex() {
+	end := strings.IndexAny(l.input[l.readPosition:], "/\n")
+	if end >= 0 && l.input[l.readPosition+end] == '/' {
+		l.regexEnd = l.readPosition + end
 	}
-	if l.input[pos] == '/' {
-		prev = true
-	}
-	return next && prev
+}
+
+// inRegex reports whether the current character is inside a regex literal,
+// where # does not start a comment.
+func (l *Lexer) inRegex() bool {
+	return l.position < l.regexEnd
 }
 
 func (l *Lexer) skipWhitespace() {
 	for l.ch == '#' || l.ch == ' ' || l.ch == '\t' || l.ch == '\r' {
 		if l.ch == '#' {
-			if l.isInsideRegex() {
+			if l.inRegex() {
 				return
 			}
+			// the newline is left to end the statement before the comment
 			l.readUntilChar('\n')
+			continue
 		}
 		l.readChar()
 	}
 }
+
+// readTrivia reads the comment or run of whitespace at the current
+// character, if there is one.
+func (l *Lexer) readTrivia() (token.Token, bool) {
+	l.startToken()
+	switch {
+	case l.ch == '#' && !l.inRegex():
+		return l.newToken(token.COMMENT, l.readUntilChar('\n')), true
+	case l.ch == ' ' || l.ch == '\t' || l.ch == '\r':
+		return l.newToken(token.WHITESPACE, l.readWhileChar(' ', '\t', '\r')), true
+	}
+	return token.Token{}, false
+}
@@ -0,0 +1,33 @@
+package lexer
+
+import (
+	"testing"
+
+	"github.com/ahalbert/strawk/pkg/token"
+)
+
+func TestRegex(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    token.Token
+		another token.TokenType // the token after the regex
+	}{
+		{"/ab/", token.Token{Type: token.REGEX, Literal: "ab"}, token.SLASH},
+		{"//", token.Token{Type: token.REGEX, Literal: ""}, token.SLASH},
+		{"/abc", token.Token{Type: token.ILLEGAL, Literal: "abc"}, token.EOF},
+		{"/ab\nc/", token.Token{Type: token.ILLEGAL, Literal: "ab"}, token.NEWLINE},
+	}
+	for _, tt := range tests {
+		// the parser sets ExpectRegex with the lexer on the opening /
+		l := New(tt.input)
+		l.ExpectRegex = true
+		tok := l.NextToken()
+		l.ExpectRegex = false
+		if tok.Type != tt.want.Type || tok.Literal != tt.want.Literal {
+			t.Errorf("%q: got %s %q, want %s %q", tt.input, tok.Type, tok.Literal, tt.want.Type, tt.want.Literal)
+		}
+		if next := l.NextToken(); next.Type != tt.another {
+			t.Errorf("%q: followed by %s, want %s", tt.input, next.Type, tt.another)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Package lint reports likely bugs in strawk programs without running them.
+package lint
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+
+	"github.com/ahalbert/strawk/pkg/ast"
+	"github.com/ahalbert/strawk/pkg/interpreter"
+)
+
+// Warning is a likely bug found in a program.
+type Warning struct {
+	Line    int
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("Warning on line %d: %s", w.Line, w.Message)
+}
+
+type linter struct {
+	warnings []Warning
+	line     int
+	strings  map[string]bool // string literals, which may name a comparison function
+}
+
+// Lint checks a parsed program, returning its warnings ordered by line. The
+// program should be free of the errors interpreter.Resolve reports.
+func Lint(program *ast.Program) []Warning {
+	res := interpreter.Resolve(program)
+	l := &linter{strings: make(map[string]bool)}
+	for _, stmt := range program.Statements {
+		l.statement(stmt)
+	}
+
+	for _, use := range res.Unassigned() {
+		if use.Function != "" {
+			l.warnf(use.Line, "local variable %s of function %s is read but never assigned", use.Name, use.Function)
+		} else {
+			l.warnf(use.Line, "variable %s is read but never assigned", use.Name)
+		}
+	}
+	for name, info := range res.Functions {
+		// asort and PROCINFO["sorted_in"] call functions named by a string
+		if info.Calls == 0 && !l.strings[name] {
+			l.warnf(info.Literal.Token.LineNum, "function %s is never called", name)
+		}
+	}
+	for _, call := range res.Undefined {
+		l.warnf(call.Line, "function %s is not defined", call.Name)
+	}
+
+	slices.SortStableFunc(l.warnings, func(a, b Warning) int {
+		return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Message, b.Message))
+	})
+	return l.warnings
+}
+
+func (l *linter) warnf(line int, format string, args ...any) {
+	l.warnings = append(l.warnings, Warning{Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) lineOf(node ast.Node) int {
+	if line := node.GetToken().LineNum; line > 0 {
+		return line
+	}
+	return l.line
+}
+
+// statements checks a block, reporting the first statement after one that
+// always leaves it.
+func (l *linter) statements(statements []ast.Statement) {
+	for idx, stmt := range statements {
+		l.statement(stmt)
+		if idx == len(statements)-1 {
+			continue
+		}
+		var keyword string
+		switch stmt.(type) {
+		case *ast.NextStatement:
+			keyword = "next"
+		case *ast.ReturnStatement:
+			keyword = "return"
+		case *ast.BreakStatement:
+			keyword = "break"
+		case *ast.ContinueStatement:
+			keyword = "continue"
+		default:
+			continue
+		}
+		l.warnf(l.lineOf(statements[idx+1]), "unreachable code after %s", keyword)
+		for _, stmt := range statements[idx+1:] {
+			l.statement(stmt)
+		}
+		return
+	}
+}
+
+func (l *linter) statement(stmt ast.Statement) {
+	if stmt == nil {
+		return
+	}
+	if line := stmt.GetToken().LineNum; line > 0 {
+		l.line = line
+	}
+	switch stmt := stmt.(type) {
+	case *ast.FunctionLiteral:
+		l.statements(stmt.Body.Statements)
+	case *ast.ExpressionStatement:
+		l.expressions(stmt.Expressions...)
+	case *ast.PrintStatement:
+		l.expressions(stmt.Expressions...)
+		l.expressions(stmt.Destination)
+	case *ast.AssignStatement:
+		l.expressions(stmt.Targets...)
+		l.expressions(stmt.Values...)
+	case *ast.ActionBlockStatement:
+		if rule, ok := stmt.Conditon.(*ast.InfixExpression); ok && rule.Operator == "~$0" {
+			l.rule(rule.Right)
+		} else {
+			l.expressions(stmt.Conditon)
+		}
+		l.statements(stmt.Statements.Statements)
+	case *ast.BeginStatement:
+		l.statements(stmt.Statements)
+	case *ast.EndStatement:
+		l.statements(stmt.Statements)
+	case *ast.IfStatement:
+		l.expressions(stmt.Conditions...)
+		for _, block := range stmt.Consequences {
+			l.statements(block.Statements)
+		}
+		if stmt.Else != nil {
+			l.statements(stmt.Else.Statements)
+		}
+	case *ast.WhileStatement:
+		l.expressions(stmt.Condition)
+		l.statements(stmt.Block.Statements)
+	case *ast.DoWhileStatement:
+		l.statements(stmt.Block.Statements)
+		l.expressions(stmt.Condition)
+	case *ast.ForStatement:
+		l.statement(stmt.Initialization)
+		l.expressions(stmt.Condition)
+		l.statement(stmt.Action)
+		l.statements(stmt.Block.Statements)
+	case *ast.ForEachStatement:
+		l.expressions(stmt.Array)
+		l.statements(stmt.Block.Statements)
+	case *ast.DeleteStatement:
+		l.expressions(stmt.ToDelete)
+	case *ast.ReturnStatement:
+		l.expressions(stmt.Value)
+	}
+}
+
+// rule checks the regex of a rule, which consumes the input it matches.
+func (l *linter) rule(expr ast.Expression) {
+	l.expressions(expr)
+	regex, ok := expr.(*ast.RegexLiteral)
+	if !ok {
+		return
+	}
+	if re, err := syntax.Parse(regex.Value, syntax.Perl); err == nil && matchesEmpty(re) {
+		l.warnf(l.lineOf(regex), "rule regex /%s/ can match the empty string, which rules skip", regex.Value)
+	}
+}
+
+func (l *linter) expressions(exprs ...ast.Expression) {
+	for _, expr := range exprs {
+		if expr != nil {
+			l.expression(expr)
+		}
+	}
+}
+
+func (l *linter) expression(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.StringLiteral:
+		l.strings[expr.Value] = true
+	case *ast.RegexLiteral:
+		if _, err := regexp.Compile(expr.Value); err != nil {
+			l.warnf(l.lineOf(expr), "regex /%s/ does not compile: %v", expr.Value, err)
+		}
+	case *ast.ArrayIndexExpression:
+		if expr.Parent != nil {
+			l.expression(expr.Parent)
+		}
+		l.expressions(expr.IndexList...)
+	case *ast.FieldExpression:
+		l.expressions(expr.Index)
+	case *ast.AssignExpression:
+		l.expressions(expr.Target, expr.Value)
+	case *ast.TernaryExpression:
+		l.expressions(expr.Condition, expr.IfTrue, expr.IfFalse)
+	case *ast.PrefixExpression:
+		l.expressions(expr.Right)
+	case *ast.PostfixExpression:
+		l.expressions(expr.Left)
+	case *ast.InfixExpression:
+		l.expressions(expr.Left, expr.Right)
+	case *ast.GetlineExpression:
+		l.expressions(expr.Target, expr.File, expr.Command)
+	case *ast.CallExpression:
+		l.call(expr)
+	}
+}
+
+// call checks the number of arguments passed to a built-in.
+func (l *linter) call(call *ast.CallExpression) {
+	l.expressions(call.Arguments...)
+	name := call.Function.String()
+	least, most, ok := interpreter.BuiltinArity(name)
+	if !ok {
+		return
+	}
+	n := len(call.Arguments)
+	if n >= least && (most < 0 || n <= most) {
+		return
+	}
+	var accepts string
+	switch {
+	case most < 0:
+		accepts = fmt.Sprintf("at least %d", least)
+	case least == most:
+		accepts = fmt.Sprint(least)
+	default:
+		accepts = fmt.Sprintf("%d to %d", least, most)
+	}
+	l.warnf(l.lineOf(call), "function %s called with %d arguments, but accepts %s", name, n, accepts)
+}
+
+// matchesEmpty reports whether a regex can match the empty string somewhere,
+// treating anchors and word boundaries as able to.
+func matchesEmpty(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpStar, syntax.OpQuest,
+		syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return true
+	case syntax.OpCapture, syntax.OpPlus:
+		return matchesEmpty(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min == 0 || matchesEmpty(re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !matchesEmpty(sub) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpAlternate:
+		return slices.ContainsFunc(re.Sub, matchesEmpty)
+	default:
+		return false
+	}
+}
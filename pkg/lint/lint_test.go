@@ -0,0 +1,55 @@
+package lint
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ahalbert/strawk/pkg/lexer"
+	"github.com/ahalbert/strawk/pkg/parser"
+)
+
+func lint(t *testing.T, src string) []string {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors) > 0 {
+		t.Fatalf("parsing %q: %v", src, p.Errors)
+	}
+	var warnings []string
+	for _, w := range Lint(program) {
+		warnings = append(warnings, w.String())
+	}
+	return warnings
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"BEGIN { x = 1; print x }", nil},
+		{"BEGIN {\n  print y\n}", []string{"Warning on line 2: variable y is read but never assigned"}},
+		{"function f(a,  tmp) { return tmp }\nBEGIN { f(1) }", []string{"Warning on line 1: local variable tmp of function f is read but never assigned"}},
+		{"BEGIN { }\nfunction unused() { }", []string{"Warning on line 2: function unused is never called"}},
+		{"function cmp(i1, v1, i2, v2) { return 0 }\nBEGIN { x[1] = 1; asort(x, y, \"cmp\") }", nil},
+		{"BEGIN { g() }", []string{"Warning on line 1: function g is not defined"}},
+		{"function f() {\n  return 1\n  print \"x\"\n}\nBEGIN { f() }", []string{"Warning on line 3: unreachable code after return"}},
+		{"/a/ {\n  next\n  print\n}", []string{"Warning on line 3: unreachable code after next"}},
+		{"BEGIN { while (1) { break; x = 1 } }", []string{"Warning on line 1: unreachable code after break"}},
+		{"/a*/ { }", []string{"Warning on line 1: rule regex /a*/ can match the empty string, which rules skip"}},
+		{"/^|b/ { }", []string{"Warning on line 1: rule regex /^|b/ can match the empty string, which rules skip"}},
+		{"/a+/ { }", nil},
+		{"BEGIN { if (\"a\" ~ /(/) { } }", []string{"Warning on line 1: regex /(/ does not compile: error parsing regexp: missing closing ): `(`"}},
+		{"BEGIN { substr(\"a\") }", []string{"Warning on line 1: function substr called with 1 arguments, but accepts 2 to 3"}},
+		{"BEGIN { sprintf() }", []string{"Warning on line 1: function sprintf called with 0 arguments, but accepts at least 1"}},
+		{"BEGIN { index(\"a\") }", []string{"Warning on line 1: function index called with 1 arguments, but accepts 2"}},
+		{"BEGIN { length(1, 2) }", []string{"Warning on line 1: function length called with 2 arguments, but accepts 0 to 1"}},
+		{"/a+/ { x = length; y = length() }", nil},
+		{"BEGIN {\n  print a\n  g()\n}", []string{"Warning on line 2: variable a is read but never assigned", "Warning on line 3: function g is not defined"}},
+	}
+	for _, test := range tests {
+		if got := lint(t, test.src); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Lint(%q) = %q, want %q", test.src, got, test.want)
+		}
+	}
+}
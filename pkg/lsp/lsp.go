@@ -0,0 +1,458 @@
+// Package lsp is a language server for strawk programs, speaking the Language
+// Server Protocol. It reports parse errors and lint warnings, and offers hover
+// docs, go to definition, completion and formatting.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ahalbert/strawk/pkg/ast"
+	"github.com/ahalbert/strawk/pkg/format"
+	"github.com/ahalbert/strawk/pkg/interpreter"
+	"github.com/ahalbert/strawk/pkg/lexer"
+	"github.com/ahalbert/strawk/pkg/lint"
+	"github.com/ahalbert/strawk/pkg/parser"
+)
+
+type server struct {
+	out       io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+// document is an open program.
+type document struct {
+	text  string
+	lines []string
+	// from the last version that parsed, so that completion keeps working
+	// while an edit is half typed
+	program    *ast.Program
+	resolution *interpreter.Resolution
+}
+
+// Serve answers the requests of a client on in until it asks the server to
+// exit or closes the connection.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{out: out, documents: make(map[string]*document)}
+	r := bufio.NewReader(in)
+	for {
+		content, err := readMessage(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(content, &msg); err != nil {
+			if err := s.replyError(nil, codeParseError, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit requested before shutdown")
+			}
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers a request, or acts on a notification. A request that
+// makes the server panic gets an error reply, and a notification that does
+// is reported in the client's log.
+func (s *server) handle(msg message) (err error) {
+	defer func() {
+		r := recover()
+		switch {
+		case r == nil:
+		case msg.ID != nil:
+			err = s.replyError(msg.ID, codeInternalError, fmt.Sprint(r))
+		default:
+			err = s.notify("window/logMessage", logMessageParams{Type: messageError, Message: fmt.Sprintf("strawk: %s failed: %v", msg.Method, r)})
+		}
+	}()
+	var result any
+	switch msg.Method {
+	case "initialize":
+		result = map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":           1, // the whole text on every change
+				"hoverProvider":              true,
+				"definitionProvider":         true,
+				"completionProvider":         map[string]any{},
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]any{"name": "strawk"},
+		}
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			return s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil && len(params.ContentChanges) > 0 {
+			changes := params.ContentChanges
+			return s.update(params.TextDocument.URI, changes[len(changes)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params documentParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			delete(s.documents, params.TextDocument.URI)
+			return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		}
+	case "textDocument/hover":
+		var params positionParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			result = s.hover(params)
+		}
+	case "textDocument/definition":
+		var params positionParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			result = s.definition(params)
+		}
+	case "textDocument/completion":
+		var params positionParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			result = s.completion(params)
+		}
+	case "textDocument/formatting":
+		var params documentParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			result = s.formatting(params)
+		}
+	default:
+		if msg.ID != nil {
+			return s.replyError(msg.ID, codeMethodNotFound, "method not found: "+msg.Method)
+		}
+	}
+	if msg.ID == nil {
+		return nil // a notification, which gets no reply
+	}
+	if err != nil {
+		return s.replyError(msg.ID, codeInvalidParams, err.Error())
+	}
+	return writeMessage(s.out, response{JSONRPC: "2.0", ID: msg.ID, Result: result})
+}
+
+func (s *server) replyError(id *json.RawMessage, code int, text string) error {
+	return writeMessage(s.out, errorResponse{JSONRPC: "2.0", ID: id, Error: responseError{Code: code, Message: text}})
+}
+
+func (s *server) notify(method string, params any) error {
+	return writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// update stores the new text of a document and publishes what is wrong
+// with it.
+func (s *server) update(uri, text string) error {
+	doc := s.documents[uri]
+	if doc == nil {
+		doc = &document{}
+		s.documents[uri] = doc
+	}
+	doc.text = text
+	doc.lines = strings.Split(text, "\n")
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: doc.check()})
+}
+
+// analysis is what checking a program found.
+type analysis struct {
+	program    *ast.Program // nil if the program does not parse
+	resolution *interpreter.Resolution
+	errors     []string // formatted like parse errors
+	warnings   []lint.Warning
+}
+
+// guarded runs fn, returning an error instead of panicking if fn panics, so
+// that a bug in checking or formatting does not stop the server.
+func guarded[T any](fn func() T) (result T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return fn(), nil
+}
+
+// analyze parses, resolves and lints a program.
+func analyze(text string) analysis {
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+	if len(p.Errors) > 0 {
+		return analysis{errors: p.Errors}
+	}
+	if program == nil {
+		return analysis{errors: []string{"Parse Error on line 1: the program could not be parsed"}}
+	}
+	res := interpreter.Resolve(program)
+	if len(res.Errors) > 0 {
+		return analysis{program: program, resolution: res, errors: res.Errors}
+	}
+	return analysis{program: program, resolution: res, warnings: lint.Lint(program)}
+}
+
+// check parses and lints the document, returning its diagnostics.
+func (doc *document) check() []Diagnostic {
+	result, err := guarded(func() analysis { return analyze(doc.text) })
+	if err != nil {
+		return []Diagnostic{{Range: doc.lineRange(1), Severity: severityError, Source: "strawk", Message: "could not check the program: " + err.Error()}}
+	}
+	if result.program != nil {
+		doc.program, doc.resolution = result.program, result.resolution
+	}
+	diagnostics := []Diagnostic{}
+	for _, msg := range result.errors {
+		line, text := splitError(msg)
+		diagnostics = append(diagnostics, Diagnostic{Range: doc.lineRange(line), Severity: severityError, Source: "strawk", Message: text})
+	}
+	for _, w := range result.warnings {
+		diagnostics = append(diagnostics, Diagnostic{Range: doc.lineRange(w.Line), Severity: severityWarning, Source: "strawk", Message: w.Message})
+	}
+	return diagnostics
+}
+
+// splitError splits an error formatted like "Parse Error on line 3: msg"
+// into the line and the message.
+func splitError(msg string) (int, string) {
+	msg = strings.TrimSpace(msg)
+	_, rest, ok := strings.Cut(msg, " on line ")
+	if !ok {
+		return 1, msg
+	}
+	number, text, ok := strings.Cut(rest, ": ")
+	line, err := strconv.Atoi(number)
+	if !ok || err != nil {
+		return 1, msg
+	}
+	return line, text
+}
+
+// lineRange is the range of the text on a 1-based line, clipped to the
+// document.
+func (doc *document) lineRange(line int) Range {
+	idx := min(max(line-1, 0), len(doc.lines)-1)
+	text := doc.lines[idx]
+	indent := len(text) - len(strings.TrimLeft(text, " \t"))
+	return Range{
+		Start: Position{Line: idx, Character: utf16Len(text[:indent])},
+		End:   Position{Line: idx, Character: utf16Len(strings.TrimRight(text, "\r"))},
+	}
+}
+
+// tokenRange is the range of a name starting at a token.
+func (doc *document) tokenRange(line, column int, name string) Range {
+	idx := min(max(line-1, 0), len(doc.lines)-1)
+	text := doc.lines[idx]
+	start := min(max(column-1, 0), len(text))
+	end := min(start+len(name), len(text))
+	return Range{
+		Start: Position{Line: idx, Character: utf16Len(text[:start])},
+		End:   Position{Line: idx, Character: utf16Len(text[:end])},
+	}
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// wordAt returns the name under a position and its range, or "" if there
+// is none.
+func (doc *document) wordAt(pos Position) (string, Range) {
+	if pos.Line < 0 || pos.Line >= len(doc.lines) {
+		return "", Range{}
+	}
+	text := doc.lines[pos.Line]
+	// find the byte offset of the UTF-16 character offset
+	offset, units := 0, 0
+	for offset < len(text) && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		offset += size
+		units++
+		if r >= 0x10000 {
+			units++
+		}
+	}
+	start, end := offset, offset
+	for start > 0 && isNameChar(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isNameChar(text[end]) {
+		end++
+	}
+	if start == end {
+		return "", Range{}
+	}
+	return text[start:end], Range{
+		Start: Position{Line: pos.Line, Character: utf16Len(text[:start])},
+		End:   Position{Line: pos.Line, Character: utf16Len(text[:end])},
+	}
+}
+
+func isNameChar(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' || ch == '_'
+}
+
+// function returns the function defined around a 0-based line, or nil.
+func (doc *document) function(line int) *ast.FunctionLiteral {
+	if doc.program == nil {
+		return nil
+	}
+	for _, stmt := range doc.program.Statements {
+		fl, ok := stmt.(*ast.FunctionLiteral)
+		if ok && fl.Token.LineNum <= line+1 && line+1 <= fl.Body.Rbrace.LineNum {
+			return fl
+		}
+	}
+	return nil
+}
+
+func (s *server) hover(params positionParams) *Hover {
+	doc := s.documents[params.TextDocument.URI]
+	if doc == nil {
+		return nil
+	}
+	name, wordRange := doc.wordAt(params.Position)
+	if signature, text, ok := interpreter.BuiltinDoc(name); ok {
+		return &Hover{Contents: markdown(signature, text), Range: wordRange}
+	}
+	if doc.resolution == nil {
+		return nil
+	}
+	if info := doc.resolution.Functions[name]; info != nil {
+		return &Hover{Contents: markdown(signature(info.Literal), docComment(info.Literal)), Range: wordRange}
+	}
+	return nil
+}
+
+// docComment returns the text of the comments on the lines directly above
+// a function.
+func docComment(fl *ast.FunctionLiteral) string {
+	leading := fl.Leading
+	start, line := len(leading), fl.Token.LineNum-1
+	for start > 0 && leading[start-1].LineNum == line {
+		start--
+		line--
+	}
+	var lines []string
+	for _, comment := range leading[start:] {
+		lines = append(lines, strings.TrimSpace(strings.TrimPrefix(comment.Literal, "#")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markdown shows a signature as code above its description.
+func markdown(signature, text string) MarkupContent {
+	value := "```awk\n" + signature + "\n```"
+	if text != "" {
+		value += "\n\n" + text
+	}
+	return MarkupContent{Kind: "markdown", Value: value}
+}
+
+func signature(fl *ast.FunctionLiteral) string {
+	var params []string
+	for _, param := range fl.Parameters {
+		params = append(params, param.Value)
+	}
+	return "function " + fl.Name.Value + "(" + strings.Join(params, ", ") + ")"
+}
+
+// definition finds where a function, or a parameter of the function around
+// the position, is defined.
+func (s *server) definition(params positionParams) *Location {
+	doc := s.documents[params.TextDocument.URI]
+	if doc == nil || doc.resolution == nil {
+		return nil
+	}
+	name, _ := doc.wordAt(params.Position)
+	if fl := doc.function(params.Position.Line); fl != nil {
+		for _, param := range fl.Parameters {
+			if param.Value == name {
+				return &Location{URI: params.TextDocument.URI, Range: doc.tokenRange(param.Token.LineNum, param.Token.Position, name)}
+			}
+		}
+	}
+	if info := doc.resolution.Functions[name]; info != nil {
+		tok := info.Literal.Name.Token
+		return &Location{URI: params.TextDocument.URI, Range: doc.tokenRange(tok.LineNum, tok.Position, name)}
+	}
+	return nil
+}
+
+// completion offers the built-ins, the program's functions and global
+// variables, and the parameters of the function around the position.
+func (s *server) completion(params positionParams) []CompletionItem {
+	items := []CompletionItem{}
+	for _, name := range interpreter.Builtins() {
+		signature, text, _ := interpreter.BuiltinDoc(name)
+		items = append(items, CompletionItem{Label: name, Kind: completionFunction, Detail: signature, Documentation: &MarkupContent{Kind: "markdown", Value: text}})
+	}
+	doc := s.documents[params.TextDocument.URI]
+	if doc == nil || doc.resolution == nil {
+		return items
+	}
+	for name, info := range doc.resolution.Functions {
+		items = append(items, CompletionItem{Label: name, Kind: completionFunction, Detail: signature(info.Literal)})
+	}
+	fl := doc.function(params.Position.Line)
+	for _, name := range doc.resolution.Globals {
+		// a parameter of the same name hides the global
+		if scope := doc.resolution.Lookup(fl, name).Scope; scope != interpreter.ScopeParam && scope != interpreter.ScopeLocal {
+			items = append(items, CompletionItem{Label: name, Kind: completionVariable, Detail: scope.String()})
+		}
+	}
+	if fl != nil {
+		for _, param := range fl.Parameters {
+			scope := doc.resolution.Lookup(fl, param.Value).Scope
+			items = append(items, CompletionItem{Label: param.Value, Kind: completionVariable, Detail: scope.String()})
+		}
+	}
+	return items
+}
+
+// formatting replaces the whole document with its canonical layout, or
+// changes nothing if it does not parse.
+func (s *server) formatting(params documentParams) []TextEdit {
+	doc := s.documents[params.TextDocument.URI]
+	if doc == nil {
+		return nil
+	}
+	type formatResult struct {
+		text string
+		err  error
+	}
+	result, err := guarded(func() formatResult {
+		formatted, err := format.Source(doc.text)
+		return formatResult{formatted, err}
+	})
+	formatted := result.text
+	if err != nil || result.err != nil || formatted == doc.text {
+		return []TextEdit{}
+	}
+	last := len(doc.lines) - 1
+	whole := Range{End: Position{Line: last, Character: utf16Len(doc.lines[last])}}
+	return []TextEdit{{Range: whole, NewText: formatted}}
+}
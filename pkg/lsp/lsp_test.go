@@ -0,0 +1,288 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+const uri = "file:///test.awk"
+
+const program = `# adds one
+function inc(n,    tmp) {
+  tmp = n + 1
+  return tmp
+}
+BEGIN { x = inc(1); print length(x) }
+`
+
+// session sends messages to a server and collects its replies by ID, and
+// the diagnostics it published, in order.
+type session struct {
+	t           *testing.T
+	in          bytes.Buffer
+	nextID      int
+	replies     map[int]json.RawMessage
+	errors      map[int]responseError
+	diagnostics [][]Diagnostic
+	logs        []string
+}
+
+func newSession(t *testing.T) *session {
+	s := &session{t: t, replies: make(map[int]json.RawMessage), errors: make(map[int]responseError)}
+	s.request("initialize", map[string]any{})
+	s.notify("initialized", map[string]any{})
+	return s
+}
+
+func (s *session) send(msg map[string]any) {
+	msg["jsonrpc"] = "2.0"
+	if err := writeMessage(&s.in, msg); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func (s *session) request(method string, params any) int {
+	s.nextID++
+	s.send(map[string]any{"id": s.nextID, "method": method, "params": params})
+	return s.nextID
+}
+
+func (s *session) notify(method string, params any) {
+	s.send(map[string]any{"method": method, "params": params})
+}
+
+func (s *session) open(text string) {
+	s.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": uri, "text": text}})
+}
+
+func (s *session) change(text string) {
+	s.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri},
+		"contentChanges": []any{map[string]any{"text": text}},
+	})
+}
+
+func (s *session) at(method string, line, character int) int {
+	return s.request(method, map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     Position{Line: line, Character: character},
+	})
+}
+
+// run serves everything sent so far, then shuts the server down.
+func (s *session) run() {
+	s.request("shutdown", nil)
+	s.notify("exit", nil)
+	var out bytes.Buffer
+	if err := Serve(&s.in, &out); err != nil {
+		s.t.Fatal(err)
+	}
+	r := bufio.NewReader(&out)
+	for {
+		content, err := readMessage(r)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		var msg struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  *responseError  `json:"error"`
+		}
+		if err := json.Unmarshal(content, &msg); err != nil {
+			s.t.Fatal(err)
+		}
+		switch {
+		case msg.Error != nil:
+			s.errors[*msg.ID] = *msg.Error
+		case msg.ID != nil:
+			s.replies[*msg.ID] = msg.Result
+		case msg.Method == "textDocument/publishDiagnostics":
+			var params publishDiagnosticsParams
+			s.decode(msg.Params, &params)
+			s.diagnostics = append(s.diagnostics, params.Diagnostics)
+		case msg.Method == "window/logMessage":
+			var params logMessageParams
+			s.decode(msg.Params, &params)
+			s.logs = append(s.logs, params.Message)
+		}
+	}
+}
+
+func (s *session) decode(content json.RawMessage, v any) {
+	if err := json.Unmarshal(content, v); err != nil {
+		s.t.Fatalf("decoding %s: %v", content, err)
+	}
+}
+
+func (s *session) reply(id int, v any) {
+	if err, ok := s.errors[id]; ok {
+		s.t.Fatalf("request %d failed: %s", id, err.Message)
+	}
+	s.decode(s.replies[id], v)
+}
+
+func TestDiagnostics(t *testing.T) {
+	s := newSession(t)
+	s.open(program + "END { print y }\n")
+	s.change("BEGIN { x = (1 }\n")
+	// typed up to the regex of a rule
+	s.change("/abc")
+	s.change("BEGIN { print 1 }\n# a comment ending the file")
+	s.change("BEGIN { x = 4 / 2 # half/whole\n}")
+	s.run()
+
+	if len(s.diagnostics) != 5 {
+		t.Fatalf("got %d sets of diagnostics, want 5", len(s.diagnostics))
+	}
+	warnings := s.diagnostics[0]
+	if len(warnings) != 1 || warnings[0].Severity != severityWarning || warnings[0].Message != "variable y is read but never assigned" {
+		t.Errorf("diagnostics of the program = %+v", warnings)
+	}
+	if warnings[0].Range.Start.Line != 6 {
+		t.Errorf("warning on line %d, want 6", warnings[0].Range.Start.Line)
+	}
+	errs := s.diagnostics[1]
+	if len(errs) != 1 || errs[0].Severity != severityError {
+		t.Errorf("diagnostics of a parse error = %+v", errs)
+	}
+	unterminated := s.diagnostics[2]
+	if len(unterminated) != 1 || unterminated[0].Message != "unterminated regex" {
+		t.Errorf("diagnostics of an unterminated regex = %+v", unterminated)
+	}
+	for _, diagnostics := range s.diagnostics[3:] {
+		if len(diagnostics) != 0 {
+			t.Errorf("diagnostics of a valid program = %+v", diagnostics)
+		}
+	}
+	if len(s.logs) > 0 {
+		t.Errorf("logged %q", s.logs)
+	}
+}
+
+func TestHover(t *testing.T) {
+	s := newSession(t)
+	s.open(program)
+	builtin := s.at("textDocument/hover", 5, 29)
+	function := s.at("textDocument/hover", 5, 13)
+	nothing := s.at("textDocument/hover", 5, 0)
+	s.change("BEGIN { x = (1 }\n")
+	stale := s.at("textDocument/hover", 0, 0)
+	s.run()
+
+	var hover Hover
+	s.reply(builtin, &hover)
+	if !strings.Contains(hover.Contents.Value, "length([x])") || hover.Range.Start.Character != 26 {
+		t.Errorf("hover over length = %+v", hover)
+	}
+	s.reply(function, &hover)
+	if !strings.Contains(hover.Contents.Value, "function inc(n, tmp)") || !strings.Contains(hover.Contents.Value, "adds one") {
+		t.Errorf("hover over inc = %+v", hover)
+	}
+	var none *Hover
+	s.reply(nothing, &none)
+	if none != nil {
+		t.Errorf("hover over BEGIN = %+v", none)
+	}
+	s.reply(stale, &none)
+	if none != nil {
+		t.Errorf("hover after a parse error = %+v", none)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	s := newSession(t)
+	s.open(program)
+	function := s.at("textDocument/definition", 5, 13)
+	param := s.at("textDocument/definition", 2, 8)
+	s.run()
+
+	var loc Location
+	s.reply(function, &loc)
+	want := Range{Start: Position{Line: 1, Character: 9}, End: Position{Line: 1, Character: 12}}
+	if loc.URI != uri || loc.Range != want {
+		t.Errorf("definition of inc = %+v, want %+v", loc, want)
+	}
+	s.reply(param, &loc)
+	want = Range{Start: Position{Line: 1, Character: 13}, End: Position{Line: 1, Character: 14}}
+	if loc.Range != want {
+		t.Errorf("definition of n = %+v, want %+v", loc.Range, want)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	s := newSession(t)
+	s.open(program)
+	inside := s.at("textDocument/completion", 2, 2)
+	outside := s.at("textDocument/completion", 5, 2)
+	s.run()
+
+	details := func(id int) map[string]string {
+		var items []CompletionItem
+		s.reply(id, &items)
+		found := make(map[string]string)
+		for _, item := range items {
+			found[item.Label] = item.Detail
+		}
+		return found
+	}
+	got := details(inside)
+	for name, detail := range map[string]string{"gsub": "gsub(regex, replacement [, target])", "inc": "function inc(n, tmp)", "x": "global", "n": "parameter", "tmp": "local"} {
+		if got[name] != detail {
+			t.Errorf("completion inside inc offers %s as %q, want %q", name, got[name], detail)
+		}
+	}
+	if _, ok := details(outside)["tmp"]; ok {
+		t.Errorf("completion outside inc offers its local tmp")
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	s := newSession(t)
+	s.open("BEGIN{x=1 # one\nprint x}\n")
+	messy := s.request("textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	s.change("BEGIN {\n  x = 1 # one\n  print x\n}\n")
+	tidy := s.request("textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	s.change("BEGIN { x = (1 }\n")
+	broken := s.request("textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	s.change("/abc")
+	unterminated := s.request("textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	s.run()
+
+	var edits []TextEdit
+	s.reply(messy, &edits)
+	want := TextEdit{Range: Range{End: Position{Line: 2}}, NewText: "BEGIN {\n  x = 1 # one\n  print x\n}\n"}
+	if len(edits) != 1 || edits[0] != want {
+		t.Errorf("formatting edits = %+v, want %+v", edits, want)
+	}
+	for _, id := range []int{tidy, broken, unterminated} {
+		s.reply(id, &edits)
+		if len(edits) != 0 {
+			t.Errorf("formatting edits = %+v, want none", edits)
+		}
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	s := newSession(t)
+	id := s.request("textDocument/rename", map[string]any{})
+	s.run()
+	if s.errors[id].Code != codeMethodNotFound {
+		t.Errorf("error = %+v, want method not found", s.errors[id])
+	}
+}
+
+func TestGuardedPanic(t *testing.T) {
+	_, err := guarded(func() int { panic("parser bug") })
+	if err == nil || err.Error() != "parser bug" {
+		t.Errorf("guarded returned %v, want the panic as an error", err)
+	}
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"slices"
 	"strconv"
 
 	"github.com/ahalbert/strawk/pkg/ast"
@@ -9,44 +10,81 @@ import (
 	"github.com/ahalbert/strawk/pkg/token"
 )
 
+// Precedences follow the POSIX awk grammar, from loosest to tightest binding.
 const (
 	_ int = iota
 	LOWEST
-	BOOLEANLOGIC // && or ||
-	REGEXMATCH   // ~ or !~
-	MEMBERSHIP   // expr in array
-	TERNARY      // condition ? a : b
-	EQUALITY     // ==
-	CONCATENATE  // implied
-	SUM          // +
-	PRODUCT      // *, /, %
-	EXPONENT     // ^
-	PREFIX       // -X or !X
-	INDEX        // []
-	CALL         // myFunction(X)
+	ASSIGNMENT  // =, +=, -=, *=, /=, %=, ^=
+	TERNARY     // condition ? a : b
+	OR          // ||
+	AND         // &&
+	MEMBERSHIP  // expr in array
+	REGEXMATCH  // ~ or !~
+	EQUALITY    // ==, !=, <, <=, >, >=
+	PIPE        // cmd | getline
+	CONCATENATE // implied
+	SUM         // +, -
+	PRODUCT     // *, /, %
+	PREFIX      // -X, +X or !X
+	EXPONENT    // ^
+	INCREMENT   // ++X, X++, --X, X--
+	FIELD       // $X
+	INDEX       // []
+	CALL        // myFunction(X)
 )
 
 var precedences = map[token.TokenType]int{
-	token.OR:            BOOLEANLOGIC,
-	token.AND:           BOOLEANLOGIC,
-	token.NOTREGEXMATCH: REGEXMATCH,
-	token.REGEXMATCH:    REGEXMATCH,
-	token.IN:            MEMBERSHIP,
-	token.TERNARY:       TERNARY,
-	token.EQ:            EQUALITY,
-	token.NOT_EQ:        EQUALITY,
-	token.LT:            EQUALITY,
-	token.GT:            EQUALITY,
-	token.LTEQ:          EQUALITY,
-	token.GTEQ:          EQUALITY,
-	token.PLUS:          SUM,
-	token.MINUS:         SUM,
-	token.ASTERISK:      PRODUCT,
-	token.SLASH:         PRODUCT,
-	token.MODULO:        PRODUCT,
-	token.EXPONENT:      EXPONENT,
-	token.LBRACKET:      INDEX,
-	token.LPAREN:        CALL,
+	token.ASSIGN:         ASSIGNMENT,
+	token.ASSIGNPLUS:     ASSIGNMENT,
+	token.ASSIGNMINUS:    ASSIGNMENT,
+	token.ASSIGNMULTIPLY: ASSIGNMENT,
+	token.ASSIGNDIVIDE:   ASSIGNMENT,
+	token.ASSIGNMODULO:   ASSIGNMENT,
+	token.ASSIGNEXPONENT: ASSIGNMENT,
+	token.TERNARY:        TERNARY,
+	token.OR:             OR,
+	token.AND:            AND,
+	token.IN:             MEMBERSHIP,
+	token.NOTREGEXMATCH:  REGEXMATCH,
+	token.REGEXMATCH:     REGEXMATCH,
+	token.EQ:             EQUALITY,
+	token.NOT_EQ:         EQUALITY,
+	token.LT:             EQUALITY,
+	token.GT:             EQUALITY,
+	token.LTEQ:           EQUALITY,
+	token.GTEQ:           EQUALITY,
+	token.PIPE:           PIPE,
+	token.PLUS:           SUM,
+	token.MINUS:          SUM,
+	token.ASTERISK:       PRODUCT,
+	token.SLASH:          PRODUCT,
+	token.MODULO:         PRODUCT,
+	token.EXPONENT:       EXPONENT,
+	token.INCREMENT:      INCREMENT,
+	token.DECREMENT:      INCREMENT,
+	token.LBRACKET:       INDEX,
+	token.LPAREN:         CALL,
+}
+
+// Tokens that may begin the right hand side of an implied concatenation.
+// Unary operators are excluded so that `a -1` remains a subtraction.
+var concatenationStarts = []token.TokenType{
+	token.IDENT,
+	token.STRING,
+	token.NUMBER,
+	token.LPAREN,
+	token.DOLLAR,
+}
+
+// Names that are read as a single variable when written directly after a $,
+// rather than as the field operator applied to a variable.
+var dollarVariables = []string{
+	"MATCHES",
+	"RSTART",
+	"RLENGTH",
+	"OFFSET",
+	"LINE",
+	"COLUMN",
 }
 
 type (
@@ -62,6 +100,19 @@ type Parser struct {
 	peekToken      token.Token
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	inPrint bool // > and | redirect output rather than compare or pipe into getline
+
+	prevToken   token.Token // the token before curToken, which ends a statement just parsed
+	comments    []comment   // comments read but not yet attached to the tree
+	lastComment token.Token // the last comment read, as backtracking reads comments again
+	lexedLine   int         // the line of the last token read from the lexer
+}
+
+// comment is a comment waiting to be attached to a statement or block.
+type comment struct {
+	token.Token
+	ownLine bool // no token comes before it on its line
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -69,6 +120,7 @@ func New(l *lexer.Lexer) *Parser {
 		l:      l,
 		Errors: []string{},
 	}
+	l.Trivia = true
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
@@ -81,14 +133,19 @@ func New(l *lexer.Lexer) *Parser {
 
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.PLUS, p.parsePrefixExpression)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(token.DOLLAR, p.parseFieldExpression)
+	p.registerPrefix(token.GETLINE, p.parseGetlineExpression)
 
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.MODULO, p.parseInfixExpression)
-	p.registerInfix(token.EXPONENT, p.parseInfixExpression)
+	p.registerInfix(token.EXPONENT, p.parseExponentExpression)
+	p.registerInfix(token.INCREMENT, p.parsePostfixExpression)
+	p.registerInfix(token.DECREMENT, p.parsePostfixExpression)
 
 	p.registerInfix(token.REGEXMATCH, p.parseInfixExpression)
 	p.registerInfix(token.NOTREGEXMATCH, p.parseInfixExpression)
@@ -103,6 +160,15 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.LTEQ, p.parseInfixExpression)
 	p.registerInfix(token.GTEQ, p.parseInfixExpression)
 	p.registerInfix(token.IN, p.parseArrayMembershipExpression)
+	p.registerInfix(token.PIPE, p.parseCommandGetlineExpression)
+
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASSIGNPLUS, p.parseAssignExpression)
+	p.registerInfix(token.ASSIGNMINUS, p.parseAssignExpression)
+	p.registerInfix(token.ASSIGNMULTIPLY, p.parseAssignExpression)
+	p.registerInfix(token.ASSIGNDIVIDE, p.parseAssignExpression)
+	p.registerInfix(token.ASSIGNMODULO, p.parseAssignExpression)
+	p.registerInfix(token.ASSIGNEXPONENT, p.parseAssignExpression)
 
 	p.registerInfix(token.TERNARY, p.parseTernaryExpression)
 	p.registerInfix(token.LBRACKET, p.parseArrayIndexExpression)
@@ -129,8 +195,56 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) nextToken() {
+	p.prevToken = p.curToken
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	p.peekToken = p.readToken()
+}
+
+// readToken returns the next token from the lexer, setting aside the
+// comments before it.
+func (p *Parser) readToken() token.Token {
+	for {
+		tok := p.l.NextToken()
+		switch tok.Type {
+		case token.WHITESPACE:
+			continue
+		case token.COMMENT:
+			if before(p.lastComment, tok) {
+				p.comments = append(p.comments, comment{Token: tok, ownLine: tok.LineNum > p.lexedLine})
+				p.lastComment = tok
+			}
+			continue
+		}
+		p.lexedLine = tok.LineNum
+		return tok
+	}
+}
+
+// before reports whether token a starts before token b.
+func before(a, b token.Token) bool {
+	return a.LineNum < b.LineNum || a.LineNum == b.LineNum && a.Position < b.Position
+}
+
+// takeComments removes and returns the comments set aside that match.
+func (p *Parser) takeComments(match func(comment) bool) []token.Token {
+	var taken []token.Token
+	kept := p.comments[:0]
+	for _, c := range p.comments {
+		if match(c) {
+			taken = append(taken, c.Token)
+		} else {
+			kept = append(kept, c)
+		}
+	}
+	p.comments = kept
+	return taken
+}
+
+// takeBlockComments takes the comments left between a block's braces.
+func (p *Parser) takeBlockComments(lbrace, rbrace token.Token) []token.Token {
+	return p.takeComments(func(c comment) bool {
+		return before(lbrace, c.Token) && before(c.Token, rbrace)
+	})
 }
 
 func (p *Parser) curTokenIs(tokens ...token.TokenType) bool {
@@ -168,6 +282,12 @@ func (p *Parser) peekPrecedence() int {
 func (p *Parser) ParseProgram() *ast.Program {
 	defer func() {
 		if r := recover(); r != nil {
+			// addParseError has recorded its error; anything else is a bug
+			// in the parser, reported rather than leaving no program and no
+			// errors.
+			if len(p.Errors) == 0 {
+				p.Errors = append(p.Errors, fmt.Sprintf("Parse Error on line %d: %v\n\n", p.curToken.LineNum, r))
+			}
 			for !p.curTokenIs(token.NEWLINE, token.SEMICOLON, token.EOF) {
 				p.nextToken()
 			}
@@ -177,15 +297,36 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
+		stmt := p.parseCommentedStatement()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 	}
+	program.Dangling = p.takeComments(func(comment) bool { return true })
 
 	return program
 }
 
+// parseCommentedStatement parses a statement, attaching the comments on the
+// lines before it and the one ending its last line.
+func (p *Parser) parseCommentedStatement() ast.Statement {
+	if p.curTokenIs(token.NEWLINE, token.SEMICOLON) {
+		return p.parseStatement()
+	}
+	// taken first, so that the statements in its blocks leave them
+	leading := p.takeComments(func(c comment) bool {
+		return c.ownLine && before(c.Token, p.curToken)
+	})
+	stmt := p.parseStatement()
+	comments := stmt.GetComments()
+	comments.Leading = leading
+	last := p.prevToken
+	comments.Trailing = p.takeComments(func(c comment) bool {
+		return !c.ownLine && c.LineNum == last.LineNum && before(last, c.Token) && before(c.Token, p.curToken)
+	})
+	return stmt
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.BEGIN:
@@ -206,6 +347,8 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseContinueStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.NEXT:
+		return p.parseNextStatement()
 	case token.IF:
 		return p.parseIfStatement()
 	case token.PRINT:
@@ -224,27 +367,22 @@ func (p *Parser) parseStatement() ast.Statement {
 }
 
 func (p *Parser) parseExpressionPrefixedStatements() ast.Statement {
-	exprs := p.parseExpressionList(token.ASSIGN, token.LBRACE)
+	first := p.curToken
+	exprs := []ast.Expression{p.parseExpression(LOWEST)}
+	// Later targets of a multiple assignment (a, b = 1, 2) must not swallow
+	// the = themselves, so they are parsed above assignment precedence.
+	for p.curTokenIs(token.COMMA) {
+		p.nextToken()
+		exprs = append(exprs, p.parseExpression(ASSIGNMENT))
+	}
 
 	switch p.curToken.Type {
 	case token.ASSIGN:
 		return p.parseAssignStatement(exprs)
-	case token.ASSIGNPLUS:
-		return p.parseAssignAndModifyStatement(exprs)
-	case token.ASSIGNMINUS:
-		return p.parseAssignAndModifyStatement(exprs)
-	case token.ASSIGNMULTIPLY:
-		return p.parseAssignAndModifyStatement(exprs)
-	case token.ASSIGNDIVIDE:
-		return p.parseAssignAndModifyStatement(exprs)
-	case token.ASSIGNMODULO:
-		return p.parseAssignAndModifyStatement(exprs)
-	case token.ASSIGNEXPONENT:
-		return p.parseAssignAndModifyStatement(exprs)
 	case token.LBRACE:
 		return p.parseActionBlockStatement(exprs)
 	default:
-		return &ast.ExpressionStatement{Token: p.curToken, Expressions: exprs}
+		return &ast.ExpressionStatement{Token: first, Expressions: exprs}
 	}
 }
 
@@ -252,14 +390,17 @@ func (p *Parser) parseBeginStatement() *ast.BeginStatement {
 	block := &ast.BeginStatement{Token: p.curToken}
 
 	p.nextToken()
+	lbrace := p.curToken
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) {
-		stmt := p.parseStatement()
+		stmt := p.parseCommentedStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 	}
+	block.Rbrace = p.curToken
+	block.Dangling = p.takeBlockComments(lbrace, block.Rbrace)
 
 	p.nextToken()
 
@@ -270,14 +411,17 @@ func (p *Parser) parseEndStatement() *ast.EndStatement {
 	block := &ast.EndStatement{Token: p.curToken}
 
 	p.nextToken()
+	lbrace := p.curToken
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) {
-		stmt := p.parseStatement()
+		stmt := p.parseCommentedStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 	}
+	block.Rbrace = p.curToken
+	block.Dangling = p.takeBlockComments(lbrace, block.Rbrace)
 	p.nextToken()
 
 	return block
@@ -308,32 +452,13 @@ func (p *Parser) parseAssignStatement(targets []ast.Expression) *ast.AssignState
 	return stmt
 }
 
-func (p *Parser) parseAssignAndModifyStatement(targets []ast.Expression) *ast.AssignAndModifyStatement {
-	if len(targets) != 1 {
-		panic(p.curToken.Literal + " should have exactly 1 target")
-	}
-
-	operator := p.curToken
-	target := targets[0]
-	switch target.(type) {
-	case *ast.Identifier:
-	case *ast.ArrayIndexExpression:
-	default:
-		p.addParseError("found non-identifier expression on lhs of assign statement")
-	}
-
-	p.nextToken()
-
-	return &ast.AssignAndModifyStatement{Operator: operator, Target: target, Value: p.parseExpression(LOWEST)}
-}
-
 func (p *Parser) parseActionBlockStatement(conditions []ast.Expression) *ast.ActionBlockStatement {
 
 	if len(conditions) != 1 {
 		p.addParseError("Action block should have exactly 1 condition")
 	}
 
-	stmt := &ast.ActionBlockStatement{Conditon: conditions[0]}
+	stmt := &ast.ActionBlockStatement{Token: conditions[0].GetToken(), Conditon: conditions[0]}
 
 	//If a regex literal by itself, expand to $0 ~ /regex/
 	switch stmt.Conditon.(type) {
@@ -350,21 +475,25 @@ func (p *Parser) parseBlock() *ast.ActionBlock {
 	if !p.curTokenIs(token.LBRACE) {
 		p.addParseError("Expected {")
 	}
+	lbrace := p.curToken
 
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) {
-		s := p.parseStatement()
+		s := p.parseCommentedStatement()
 		if s != nil {
 			block.Statements = append(block.Statements, s)
 		}
 	}
+	block.Rbrace = p.curToken
+	block.Dangling = p.takeBlockComments(lbrace, block.Rbrace)
 
 	p.nextToken()
 	return block
 }
 
 func (p *Parser) parseIfStatement() *ast.IfStatement {
+	t := p.curToken
 	if !p.curTokenIs(token.IF) {
 		p.addParseError("Expected if")
 	}
@@ -375,7 +504,7 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 		p.addParseError("Expected {")
 	}
 	consequence := p.parseBlock()
-	stmt := &ast.IfStatement{}
+	stmt := &ast.IfStatement{Token: t}
 	stmt.Conditions = append(stmt.Conditions, condition)
 	stmt.Consequences = append(stmt.Consequences, consequence)
 	// for p.curTokenIs(token.NEWLINE) {
@@ -395,16 +524,18 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 }
 
 func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	t := p.curToken
 	if !p.curTokenIs(token.WHILE) {
 		p.addParseError("Expected while")
 	}
 	p.nextToken()
 	condition := p.parseExpression(LOWEST)
 	loop := p.parseBlock()
-	return &ast.WhileStatement{Condition: condition, Block: loop}
+	return &ast.WhileStatement{Token: t, Condition: condition, Block: loop}
 }
 
 func (p *Parser) parseDoWhileStatement() *ast.DoWhileStatement {
+	t := p.curToken
 	if !p.curTokenIs(token.DO) {
 		p.addParseError("Expected do")
 	}
@@ -415,7 +546,7 @@ func (p *Parser) parseDoWhileStatement() *ast.DoWhileStatement {
 	}
 	p.nextToken()
 	condition := p.parseExpression(LOWEST)
-	return &ast.DoWhileStatement{Condition: condition, Block: loop}
+	return &ast.DoWhileStatement{Token: t, Condition: condition, Block: loop}
 }
 
 func (p *Parser) parseForStatement() ast.Statement {
@@ -432,14 +563,14 @@ func (p *Parser) parseForStatement() ast.Statement {
 	if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.IN) {
 		keyVariable := p.parseIdentifierExpr()
 		p.nextToken()
-		arrayName := p.parseIdentifierExpr()
+		arrayName := p.parseArrayName()
 		if !p.curTokenIs(token.RPAREN) {
 			p.addParseError("Expected )")
 		}
 		p.nextToken()
 		return &ast.ForEachStatement{Token: t,
 			VarName: keyVariable.(*ast.Identifier),
-			Array:   arrayName.(*ast.Identifier),
+			Array:   arrayName,
 			Block:   p.parseBlock()}
 	}
 
@@ -460,6 +591,7 @@ func (p *Parser) parseForStatement() ast.Statement {
 	p.nextToken()
 	block := p.parseBlock()
 	return &ast.ForStatement{
+		Token:          t,
 		Initialization: init,
 		Condition:      condition,
 		Action:         action,
@@ -468,32 +600,82 @@ func (p *Parser) parseForStatement() ast.Statement {
 }
 
 func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
 	p.nextToken()
-	return &ast.BreakStatement{}
+	return stmt
 }
 
 func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
 	p.nextToken()
-	return &ast.ContinueStatement{}
+	return stmt
 }
 
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+	stmt := &ast.ReturnStatement{Token: p.curToken}
 	p.nextToken()
-	return &ast.ReturnStatement{Value: p.parseExpression(LOWEST)}
+	if !p.curTokenIs(token.NEWLINE, token.SEMICOLON, token.RBRACE) {
+		stmt.Value = p.parseExpression(LOWEST)
+	}
+	return stmt
 }
 
 func (p *Parser) parseNextStatement() *ast.NextStatement {
+	stmt := &ast.NextStatement{Token: p.curToken}
 	p.nextToken()
-	return &ast.NextStatement{}
+	return stmt
 }
 
 func (p *Parser) parsePrintStatement() *ast.PrintStatement {
 	stmt := &ast.PrintStatement{Token: p.curToken}
 	p.nextToken()
-	stmt.Expressions = p.parseExpressionList(token.SEMICOLON)
+	if !p.curTokenIs(token.NEWLINE, token.SEMICOLON, token.RBRACE, token.EOF, token.GT, token.APPEND, token.PIPE) {
+		p.inPrint = true
+		stmt.Expressions = p.parseExpressionList(token.SEMICOLON)
+		p.inPrint = false
+	}
+	if p.curTokenIs(token.GT, token.APPEND, token.PIPE) {
+		stmt.Redirect = p.curToken
+		p.nextToken()
+		stmt.Destination = p.parseExpression(EQUALITY)
+	}
 	return stmt
 }
 
+// parseGetlineExpression parses getline [var] < file.
+func (p *Parser) parseGetlineExpression() ast.Expression {
+	expr := &ast.GetlineExpression{Token: p.curToken}
+	p.nextToken()
+	expr.Target = p.parseGetlineTarget()
+	if !p.curTokenIs(token.LT) {
+		p.addParseError("getline reads from a file with getline < file or a command with cmd | getline")
+	}
+	p.nextToken()
+	expr.File = p.parseExpression(CONCATENATE)
+	return expr
+}
+
+// parseCommandGetlineExpression parses cmd | getline [var].
+func (p *Parser) parseCommandGetlineExpression(command ast.Expression) ast.Expression {
+	p.nextToken()
+	if !p.curTokenIs(token.GETLINE) {
+		p.addParseError("expected getline after |")
+	}
+	expr := &ast.GetlineExpression{Token: p.curToken, Command: command}
+	p.nextToken()
+	expr.Target = p.parseGetlineTarget()
+	return expr
+}
+
+func (p *Parser) parseGetlineTarget() ast.Expression {
+	if !p.curTokenIs(token.IDENT, token.DOLLAR) {
+		return nil
+	}
+	target := p.parseExpression(INCREMENT)
+	p.expectLvalue(target, "getline")
+	return target
+}
+
 func (p *Parser) parseExpressionList(end ...token.TokenType) []ast.Expression {
 
 	list := []ast.Expression{}
@@ -521,41 +703,48 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	}
 	leftExp := prefix()
 
-	if !p.curTokenIs(token.SEMICOLON, token.COMMA, token.ASSIGN, token.NEWLINE, token.ASSIGNPLUS, token.LBRACE, token.COLON, token.RBRACKET) && precedence < p.curPrecedence() {
-		for !p.curTokenIs(token.SEMICOLON, token.COMMA, token.ASSIGN, token.NEWLINE, token.ASSIGNPLUS, token.LBRACE, token.COLON, token.RBRACKET) && precedence < p.curPrecedence() {
-			infix := p.infixParseFns[p.curToken.Type]
-			if infix == nil {
+	for {
+		if p.isConcatenation(leftExp) {
+			if precedence >= CONCATENATE {
 				return leftExp
 			}
-			leftExp = infix(leftExp)
+			leftExp = p.parseConcatenateExpression(leftExp)
+			continue
 		}
-		return leftExp
+		if p.inPrint && p.curTokenIs(token.GT, token.APPEND, token.PIPE) {
+			return leftExp
+		}
+		infix := p.infixParseFns[p.curToken.Type]
+		if infix == nil || precedence >= p.curPrecedence() {
+			return leftExp
+		}
+		leftExp = infix(leftExp)
 	}
+}
 
-	_, pok := p.prefixParseFns[p.curToken.Type]
-	if pok && precedence <= p.curPrecedence() {
-		return p.parseConcatenateExpression(leftExp)
+// isConcatenation reports whether the current token begins an expression
+// that is implicitly concatenated onto left. A ( only starts a function call
+// when it directly follows a function name.
+func (p *Parser) isConcatenation(left ast.Expression) bool {
+	if p.curTokenIs(token.LPAREN) {
+		_, isIdent := left.(*ast.Identifier)
+		return !isIdent
 	}
-	return leftExp
+	return p.curTokenIs(concatenationStarts...)
 }
 
 func (p *Parser) parseIdentifierExpr() ast.Expression {
-	defer p.nextToken()
-	ident := &ast.Identifier{Value: p.curToken.Literal}
-	if p.peekTokenIs(token.INCREMENT) {
-		expr := &ast.PostfixExpression{Left: ident, Operator: p.peekToken.Literal}
-		p.nextToken()
-		return expr
-	} else if p.peekTokenIs(token.DECREMENT) {
-		expr := &ast.PostfixExpression{Left: ident, Operator: p.peekToken.Literal}
-		p.nextToken()
-		return expr
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.nextToken()
+	if ident.Value == "length" && !p.curTokenIs(token.LPAREN) {
+		// length without parentheses is the length of $0
+		return &ast.CallExpression{Token: ident.Token, Function: ident}
 	}
 	return ident
 }
 
 func (p *Parser) parseStringLiteralExpr() ast.Expression {
-	lit := &ast.StringLiteral{Value: p.curToken.Literal}
+	lit := &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 	p.nextToken()
 	return lit
 }
@@ -565,15 +754,52 @@ func (p *Parser) parseNumericLiteralExpr() ast.Expression {
 	if err != nil {
 		p.addParseError("unparsable numeric type")
 	}
-	lit := &ast.NumericLiteral{Value: val}
+	lit := &ast.NumericLiteral{Token: p.curToken, Value: val}
 	p.nextToken()
 	return lit
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
-	expression := &ast.PrefixExpression{Operator: p.curToken.Literal}
+	expression := &ast.PrefixExpression{Token: p.curToken, Operator: p.curToken.Literal}
+	precedence := PREFIX
+	if p.curTokenIs(token.INCREMENT, token.DECREMENT) {
+		precedence = INCREMENT
+	}
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+	if expression.Operator == "++" || expression.Operator == "--" {
+		p.expectLvalue(expression.Right, expression.Operator)
+	}
+	return expression
+}
+
+func (p *Parser) parsePostfixExpression(left ast.Expression) ast.Expression {
+	p.expectLvalue(left, p.curToken.Literal)
+	expression := &ast.PostfixExpression{Token: p.curToken, Left: left, Operator: p.curToken.Literal}
+	p.nextToken()
+	return expression
+}
+
+func (p *Parser) expectLvalue(expr ast.Expression, operator string) {
+	switch expr.(type) {
+	case *ast.Identifier:
+	case *ast.ArrayIndexExpression:
+	case *ast.FieldExpression:
+	default:
+		p.addParseError(fmt.Sprintf("%s applied to non-variable %s", operator, expr.String()))
+	}
+}
+
+func (p *Parser) parseFieldExpression() ast.Expression {
+	if p.peekTokenIs(token.IDENT) && slices.Contains(dollarVariables, p.peekToken.Literal) {
+		p.nextToken()
+		ident := &ast.Identifier{Token: p.curToken, Value: "$" + p.curToken.Literal}
+		p.nextToken()
+		return ident
+	}
+	expression := &ast.FieldExpression{Token: p.curToken}
 	p.nextToken()
-	expression.Right = p.parseExpression(PREFIX)
+	expression.Index = p.parseExpression(FIELD)
 	return expression
 }
 
@@ -590,6 +816,36 @@ func (p *Parser) parseConcatenateExpression(left ast.Expression) ast.Expression
 	return expression
 }
 
+// Assignment is right associative, so a = b = 0 assigns 0 to b and then to a.
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	p.expectLvalue(target, p.curToken.Literal)
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: p.curToken,
+		Target:   target,
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGNMENT - 1)
+
+	return expression
+}
+
+// Exponentiation is right associative, so the right hand side is parsed at a
+// slightly lower precedence to let a following ^ bind to it first.
+func (p *Parser) parseExponentExpression(left ast.Expression) ast.Expression {
+	expression := &ast.InfixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Left:     left,
+	}
+
+	p.nextToken()
+	expression.Right = p.parseExpression(EXPONENT - 1)
+
+	return expression
+}
+
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	expression := &ast.InfixExpression{
 		Token:    p.curToken,
@@ -608,6 +864,7 @@ func (p *Parser) parseRegexExpression() ast.Expression {
 	if !p.curTokenIs(token.SLASH) {
 		return nil
 	}
+	tok := p.curToken
 
 	p.l.ExpectRegex = true
 	var doubleBacktrack bool
@@ -621,29 +878,50 @@ func (p *Parser) parseRegexExpression() ast.Expression {
 	p.nextToken()
 	regex := p.peekToken.Literal
 	p.l.ExpectRegex = false
+	if p.peekTokenIs(token.ILLEGAL) {
+		p.addParseError("unterminated regex")
+	}
 	if doubleBacktrack {
 		p.nextToken()
 		p.nextToken()
 	}
 
-	for !p.curTokenIs(token.SLASH) {
+	for !p.curTokenIs(token.SLASH, token.EOF) {
 		p.nextToken()
 	}
 
 	p.nextToken()
 
-	return &ast.RegexLiteral{Value: regex}
+	return &ast.RegexLiteral{Token: tok, Value: regex}
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	defer p.allowComparisons()()
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	p.nextToken()
+	if p.curTokenIs(token.RPAREN) {
+		p.nextToken()
+		return exp
+	}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if !p.curTokenIs(token.RPAREN) {
+		p.addParseError("expected )")
+	}
 	p.nextToken()
 	return exp
 }
 
+// allowComparisons lets > and | inside parentheses or brackets in a print
+// statement compare and pipe again. The returned function restores the
+// previous state.
+func (p *Parser) allowComparisons() func() {
+	inPrint := p.inPrint
+	p.inPrint = false
+	return func() { p.inPrint = inPrint }
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	defer p.allowComparisons()()
 	p.nextToken()
 
 	exprs := p.parseExpressionList(token.RPAREN)
@@ -662,7 +940,7 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 }
 
 func (p *Parser) parseTernaryExpression(expr ast.Expression) ast.Expression {
-	ternaryExpr := &ast.TernaryExpression{Condition: expr}
+	ternaryExpr := &ast.TernaryExpression{Token: p.curToken, Condition: expr}
 	p.nextToken()
 	ternaryExpr.IfTrue = p.parseExpression(LOWEST)
 	if !p.curTokenIs(token.COLON) {
@@ -670,34 +948,28 @@ func (p *Parser) parseTernaryExpression(expr ast.Expression) ast.Expression {
 		// p.addError(fmt.Sprintf("expected ), got %s %s", p.curToken.Type, p.curToken.Literal))
 	}
 	p.nextToken()
-	ternaryExpr.IfFalse = p.parseExpression(LOWEST)
+	ternaryExpr.IfFalse = p.parseExpression(TERNARY - 1)
 	return ternaryExpr
 }
 
 func (p *Parser) parseArrayIndexExpression(expr ast.Expression) ast.Expression {
-	var id string
+	defer p.allowComparisons()()
+	arrayIndexExpression := &ast.ArrayIndexExpression{Token: expr.GetToken()}
 	switch expr.(type) {
 	case *ast.Identifier:
-		id = expr.String()
+		arrayIndexExpression.ArrayName = expr.String()
+	case *ast.ArrayIndexExpression:
+		arrayIndexExpression.Parent = expr.(*ast.ArrayIndexExpression)
+		arrayIndexExpression.ArrayName = arrayIndexExpression.Parent.ArrayName
 	default:
 		p.addParseError("Attempt to address array with non-identifier")
 	}
 	p.nextToken()
-	indicies := p.parseExpressionList()
-	arrayIndexExpression := &ast.ArrayIndexExpression{ArrayName: id, IndexList: indicies}
+	arrayIndexExpression.IndexList = p.parseExpressionList()
 
-	if p.peekTokenIs(token.INCREMENT) {
-		expr := &ast.PostfixExpression{Left: arrayIndexExpression, Operator: p.peekToken.Literal}
-		p.nextToken()
-		p.nextToken()
-		return expr
-	} else if p.peekTokenIs(token.DECREMENT) {
-		expr := &ast.PostfixExpression{Left: arrayIndexExpression, Operator: p.peekToken.Literal}
-		p.nextToken()
-		p.nextToken()
-		return expr
+	if !p.curTokenIs(token.RBRACKET) {
+		p.addParseError("expected ]")
 	}
-
 	p.nextToken()
 	return arrayIndexExpression
 }
@@ -709,16 +981,37 @@ func (p *Parser) parseArrayMembershipExpression(left ast.Expression) ast.Express
 		Left:     left,
 	}
 	p.nextToken()
-	if !p.curTokenIs(token.IDENT) {
-		p.addParseError("key in array expression: expected identifier on the right.")
-	}
-	right := p.parseExpression(LOWEST)
-	expr.Right = right
+	expr.Right = p.parseArrayName()
 	return expr
 }
 
+// parseArrayName parses the name of an array, including arrays such as
+// $MATCHES that are spelled with a leading $ and subarrays such as a[k].
+func (p *Parser) parseArrayName() ast.Expression {
+	var name ast.Expression
+	switch p.curToken.Type {
+	case token.IDENT:
+		name = p.parseIdentifierExpr()
+	case token.DOLLAR:
+		name = p.parseFieldExpression()
+	default:
+		p.addParseError("expected array name")
+		return nil
+	}
+	for p.curTokenIs(token.LBRACKET) {
+		name = p.parseArrayIndexExpression(name)
+	}
+	switch name.(type) {
+	case *ast.Identifier:
+	case *ast.ArrayIndexExpression:
+	default:
+		p.addParseError("expected array name")
+	}
+	return name
+}
+
 func (p *Parser) parseFunctionLiteral() *ast.FunctionLiteral {
-	function := &ast.FunctionLiteral{}
+	function := &ast.FunctionLiteral{Token: p.curToken}
 	if !p.curTokenIs(token.FUNCTION) {
 		p.addParseError("expected function keyword")
 	}
@@ -752,12 +1045,14 @@ func (p *Parser) parseFunctionLiteral() *ast.FunctionLiteral {
 }
 
 func (p *Parser) parseDeleteStatement() *ast.DeleteStatement {
+	stmt := &ast.DeleteStatement{Token: p.curToken}
 	p.nextToken()
-	expr := p.parseExpression(LOWEST)
-	switch expr.(type) {
+	stmt.ToDelete = p.parseExpression(LOWEST)
+	switch stmt.ToDelete.(type) {
 	case *ast.ArrayIndexExpression:
+	case *ast.Identifier:
 	default:
-		p.addParseError("Expected Array Index Expression with delete statement")
+		p.addParseError("Expected array or array element with delete statement")
 	}
-	return &ast.DeleteStatement{ToDelete: expr.(*ast.ArrayIndexExpression)}
+	return stmt
 }
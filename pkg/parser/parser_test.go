@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ahalbert/strawk/pkg/ast"
+	"github.com/ahalbert/strawk/pkg/lexer"
+)
+
+// parseExpression parses input as the only statement of a BEGIN block and
+// returns it with every operation parenthesized.
+func parseExpression(t *testing.T, input string) string {
+	t.Helper()
+	p := New(lexer.New("BEGIN { " + input + " }"))
+	program := p.ParseProgram()
+	if len(p.Errors) > 0 {
+		t.Fatalf("%q: %q", input, p.Errors)
+	}
+	begin := program.Statements[0].(*ast.BeginStatement)
+	if len(begin.Statements) != 1 {
+		t.Fatalf("%q: parsed as %d statements", input, len(begin.Statements))
+	}
+	return begin.Statements[0].String()
+}
+
+// TestPrecedence checks each level of the precedence table against the
+// levels next to it, from the loosest binding to the tightest. String
+// literals print without their quotes.
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		// assignment, right associative
+		{"x = y = 1", "(x = (y = 1))"},
+		{"x += y -= 2", "(x += (y -= 2))"},
+		{"x = a ? b : c", "(x = (a ? b : c))"},
+		{"x = 1 || 2", "(x = (1 || 2))"},
+		// ternary, right associative
+		{"a ? b : c ? d : e", "(a ? b : (c ? d : e))"},
+		{"a || b ? c : d", "((a || b) ? c : d)"},
+		// ||
+		{"a || b || c", "((a || b) || c)"},
+		{"a || b && c", "(a || (b && c))"},
+		// &&
+		{"a && b && c", "((a && b) && c)"},
+		{"a && b in arr", "(a && (b in arr))"},
+		{"a in arr && b", "((a in arr) && b)"},
+		// in
+		{"a ~ b in arr", "((a ~ b) in arr)"},
+		{"(a, b) in arr", "([a, b] in arr)"},
+		// ~ and !~
+		{"a !~ b ~ c", "((a !~ b) ~ c)"},
+		{"a ~ b == c", "(a ~ (b == c))"},
+		// equality and comparison
+		{"a != b < c", "((a != b) < c)"},
+		{"a == b + c", "(a == (b + c))"},
+		{"a < b c", "(a < (b . c))"},
+		// concatenation
+		{"a b c", "((a . b) . c)"},
+		{"a b + c", "(a . (b + c))"},
+		{"a++ b", "((a++) . b)"},
+		{"!a b", "((!a) . b)"},
+		{"f(a) g(b)", "(f(a) . g(b))"},
+		// sum
+		{"a - b - c", "((a - b) - c)"},
+		{"a + b * c", "(a + (b * c))"},
+		// product
+		{"a * b / c % d", "(((a * b) / c) % d)"},
+		{"-a * b", "((-a) * b)"},
+		// unary
+		{"- -a", "(-(-a))"},
+		{"!a + b", "((!a) + b)"},
+		{"-a ^ b", "(-(a ^ b))"},
+		// ^, right associative
+		{"a ^ b ^ c", "(a ^ (b ^ c))"},
+		{"a ^ -b", "(a ^ (-b))"},
+		{"++a ^ 2", "((++a) ^ 2)"},
+		// ++ and --
+		{"-a++", "(-(a++))"},
+		{"a++ + ++b", "((a++) + (++b))"},
+		{"a-- - --b", "((a--) - (--b))"},
+		// indexing
+		{"arr[i]++", "(arr[i]++)"},
+		{"-arr[1] ^ 2", "(-(arr[1] ^ 2))"},
+		{"arr[i, j] + 1", "(arr[i, j] + 1)"},
+		{"arr[i][j] * 2", "(arr[i][j] * 2)"},
+		// calls
+		{"length(x) + 1", "(length(x) + 1)"},
+		{"-f(a) ^ 2", "(-(f(a) ^ 2))"},
+		{"f(a, b c)", "f(a, (b . c))"},
+		{"length + 1", "(length() + 1)"},
+		{"length length", "(length() . length())"},
+		// pipe, between concatenation and comparison
+		{`"cmd" | getline x`, "(cmd | getline x)"},
+		{"a b | getline", "((a . b) | getline)"},
+		{"a < b | getline", "(a < (b | getline))"},
+		{`"cmd" | getline > 0`, "((cmd | getline) > 0)"},
+		// $
+		{"$x ^ 2", "($x ^ 2)"},
+		{"$i++", "($i++)"},
+		{"-$1", "(-$1)"},
+		{"!$1", "(!$1)"},
+		{"$1 $2", "($1 . $2)"},
+		{"$NF - 1", "($NF - 1)"},
+		{"$(i + 1)", "$(i + 1)"},
+		// - or + after an operand subtracts or adds, it does not start a
+		// concatenated operand, so x " " -1 is x (" " - 1)
+		{"x -1", "(x - 1)"},
+		{"x - -1", "(x - (-1))"},
+		{`x " " -1`, "(x . (  - 1))"},
+		{`x "a" -1`, "(x . (a - 1))"},
+		{`x "a" +1`, "(x . (a + 1))"},
+		{`x " " (-1)`, "((x .  ) . (-1))"},
+	}
+	for _, tt := range tests {
+		if got := parseExpression(t, tt.input); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestUnterminatedRegex(t *testing.T) {
+	for _, input := range []string{
+		"/abc",
+		"BEGIN { x = /ab }",
+		"/ab\n/ { print }",
+		"BEGIN { if ($0 ~ /a",
+	} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors) != 1 || !strings.Contains(p.Errors[0], "unterminated regex") {
+			t.Errorf("%q: errors %q, want an unterminated regex", input, p.Errors)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package strawk
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/ahalbert/strawk/pkg/ast"
+	"github.com/ahalbert/strawk/pkg/interpreter"
+	"github.com/ahalbert/strawk/pkg/lexer"
+	"github.com/ahalbert/strawk/pkg/token"
+)
+
+// builtin is the form the interpreter calls built-in functions in.
+type builtin = func(*interpreter.Interpreter, []ast.Expression) ast.Expression
+
+var (
+	valueType = reflect.TypeOf(Value{})
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// RegisterFunc makes fn callable from the program as name. fn may be any Go
+// function whose parameters and results are strings, numbers, bools or
+// Values, with an optional final error result, such as func(string) string
+// or func(float64, float64) float64. Calls must pass exactly as many
+// arguments as fn takes, or at least as many as its fixed parameters if it is
+// variadic. An error returned by fn stops the run with a runtime error.
+//
+// Functions must be registered before the program is run.
+func (p *Program) RegisterFunc(name string, fn any) error {
+	l := lexer.New(name)
+	if tok := l.NextToken(); tok.Type != token.IDENT || tok.Literal != name || l.NextToken().Type != token.EOF {
+		return fmt.Errorf("%q is not a valid function name", name)
+	}
+	if _, _, ok := interpreter.BuiltinArity(name); ok {
+		return fmt.Errorf("cannot redefine built-in function %s", name)
+	}
+	if _, ok := p.code.Resolution().Functions[name]; ok {
+		return fmt.Errorf("function %s is already defined by the program", name)
+	}
+
+	f, err := adaptFunc(name, reflect.ValueOf(fn))
+	if err != nil {
+		return err
+	}
+	if p.funcs == nil {
+		p.funcs = make(map[string]builtin)
+	}
+	p.funcs[name] = f
+	return nil
+}
+
+// adaptFunc wraps a Go function so that it converts its arguments from
+// strawk values and its result back.
+func adaptFunc(name string, fn reflect.Value) (builtin, error) {
+	if fn.Kind() != reflect.Func || fn.IsNil() {
+		return nil, fmt.Errorf("function %s: %v is not a function", name, fn.Type())
+	}
+	ft := fn.Type()
+	for idx := range ft.NumIn() {
+		in := ft.In(idx)
+		if ft.IsVariadic() && idx == ft.NumIn()-1 {
+			in = in.Elem()
+		}
+		if !isScalarType(in) {
+			return nil, fmt.Errorf("function %s: unsupported parameter type %v", name, ft.In(idx))
+		}
+	}
+	returnsError := ft.NumOut() > 0 && ft.Out(ft.NumOut()-1) == errorType
+	results := ft.NumOut()
+	if returnsError {
+		results--
+	}
+	if results > 1 || results == 1 && !isScalarType(ft.Out(0)) {
+		return nil, fmt.Errorf("function %s: results must be a single string, number, bool or Value and an optional error", name)
+	}
+
+	fixed := ft.NumIn()
+	if ft.IsVariadic() {
+		fixed--
+	}
+	return func(i *interpreter.Interpreter, args []ast.Expression) ast.Expression {
+		if len(args) < fixed || !ft.IsVariadic() && len(args) > fixed {
+			panic("Incorrect number of arguments to function " + name)
+		}
+		in := make([]reflect.Value, len(args))
+		for idx, arg := range args {
+			v, ok := valueFromExpression(arg)
+			if !ok {
+				panic(fmt.Sprintf("argument %d to function %s is not a scalar", idx+1, name))
+			}
+			paramType := ft.In(min(idx, ft.NumIn()-1))
+			if idx >= fixed {
+				paramType = paramType.Elem()
+			}
+			in[idx] = toGo(v, paramType)
+		}
+
+		out := fn.Call(in)
+		if returnsError && !out[len(out)-1].IsNil() {
+			panic(fmt.Sprintf("function %s: %v", name, out[len(out)-1].Interface()))
+		}
+		if results == 0 {
+			return &ast.StringLiteral{Value: ""}
+		}
+		return fromGo(out[0]).expression()
+	}, nil
+}
+
+func isScalarType(t reflect.Type) bool {
+	if t == valueType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func toGo(v Value, t reflect.Type) reflect.Value {
+	if t == valueType {
+		return reflect.ValueOf(v)
+	}
+	out := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		out.SetString(v.String())
+	case reflect.Bool:
+		out.SetBool(v.Bool())
+	case reflect.Float32, reflect.Float64:
+		out.SetFloat(v.Float())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		out.SetInt(int64(v.Float()))
+	default:
+		out.SetUint(uint64(v.Float()))
+	}
+	return out
+}
+
+func fromGo(v reflect.Value) Value {
+	if v.Type() == valueType {
+		return v.Interface().(Value)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return Str(v.String())
+	case reflect.Bool:
+		if v.Bool() {
+			return Num(1)
+		}
+		return Num(0)
+	case reflect.Float32, reflect.Float64:
+		return Num(v.Float())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Num(float64(v.Int()))
+	default:
+		return Num(float64(v.Uint()))
+	}
+}
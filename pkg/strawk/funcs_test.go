@@ -0,0 +1,127 @@
+package strawk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// run runs a program with the given functions registered and returns what
+// it printed.
+func run(t *testing.T, src string, funcs map[string]any) (string, error) {
+	t.Helper()
+	p := mustCompile(t, src)
+	for name, fn := range funcs {
+		if err := p.RegisterFunc(name, fn); err != nil {
+			t.Fatalf("RegisterFunc(%q): %v", name, err)
+		}
+	}
+	var out bytes.Buffer
+	err := p.Run(context.Background(), strings.NewReader(""), &out)
+	return out.String(), err
+}
+
+func TestRegisterFuncAdapters(t *testing.T) {
+	funcs := map[string]any{
+		"shout":   strings.ToUpper,
+		"hyp":     func(a, b float64) float64 { return a*a + b*b },
+		"half":    func(n int) int { return n / 2 },
+		"small":   func(n uint8) bool { return n < 10 },
+		"kind":    func(v Value) string { return fmt.Sprint(v.IsNum()) },
+		"join":    func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+		"nothing": func() {},
+		"check": func(s string) (string, error) {
+			if s == "" {
+				return "", errors.New("empty")
+			}
+			return s, nil
+		},
+	}
+	out, err := run(t, `BEGIN {
+  print shout("hi"), hyp(3, 4), half(7), small(3), small("12")
+  print kind(1), kind("a"), join("-"), join("-", "a", 2, "c")
+  print "[" nothing() "]", check("ok")
+}`, funcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "HI 25 3 1 0\ntrue false  a-2-c\n[] ok\n"
+	if out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+}
+
+func TestRegisterFuncErrors(t *testing.T) {
+	p := mustCompile(t, `function mine() { }`)
+	for name, fn := range map[string]any{
+		"length":   strings.ToUpper,
+		"mine":     strings.ToUpper,
+		"not name": strings.ToUpper,
+		"BEGIN":    strings.ToUpper,
+		"slice":    func(s []string) string { return "" },
+		"twice":    func() (string, string) { return "", "" },
+		"notfunc":  42,
+	} {
+		if err := p.RegisterFunc(name, fn); err == nil {
+			t.Errorf("RegisterFunc(%q) succeeded", name)
+		}
+	}
+}
+
+func TestRegisteredFuncRuntimeErrors(t *testing.T) {
+	funcs := map[string]any{
+		"one":  func(s string) string { return s },
+		"some": func(s string, rest ...string) string { return s },
+		"fail": func() error { return errors.New("it broke") },
+	}
+	for src, want := range map[string]string{
+		`BEGIN { one() }`:             "Incorrect number of arguments to function one",
+		`BEGIN { one(1, 2) }`:         "Incorrect number of arguments to function one",
+		`BEGIN { some() }`:            "Incorrect number of arguments to function some",
+		`BEGIN { a[1] = 1; one(a) }`:  "argument 1 to function one is not a scalar",
+		`BEGIN { fail() }`:            "function fail: it broke",
+		`BEGIN { print undefined() }`: "function undefined is not defined",
+	} {
+		_, err := run(t, src, funcs)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %v, want %q", src, err, want)
+		}
+	}
+}
+
+// A Go runtime error is a bug, not an error in the program, so it is not
+// turned into a runtime error with a line number.
+func TestRegisteredFuncGoPanic(t *testing.T) {
+	defer func() {
+		if _, ok := recover().(runtime.Error); !ok {
+			t.Error("the Go runtime error was not passed on")
+		}
+	}()
+	var m map[string]int
+	run(t, `BEGIN { crash() }`, map[string]any{"crash": func() { m["x"] = 1 }})
+}
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		v     Value
+		str   string
+		num   float64
+		truth bool
+	}{
+		{Num(0), "0", 0, false},
+		{Num(2.5), "2.5", 2.5, true},
+		{Str(""), "", 0, false},
+		{Str("0"), "0", 0, false},
+		{Str("0.0"), "0.0", 0, true},
+		{Str(" 12abc"), " 12abc", 12, true},
+	}
+	for _, test := range tests {
+		if test.v.String() != test.str || test.v.Float() != test.num || test.v.Bool() != test.truth {
+			t.Errorf("%#v: got %q, %v, %v", test.v, test.v.String(), test.v.Float(), test.v.Bool())
+		}
+	}
+}
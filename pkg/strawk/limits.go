@@ -0,0 +1,18 @@
+package strawk
+
+import "github.com/ahalbert/strawk/pkg/interpreter"
+
+// Limits bounds the resources a program may use, so that untrusted programs
+// can be run safely. A zero value means no limit.
+type Limits = interpreter.Limits
+
+// ErrLimitExceeded is wrapped by the error Run returns when a program goes
+// over one of its Limits.
+var ErrLimitExceeded = interpreter.ErrLimitExceeded
+
+// LimitError reports which limit a program exceeded and on which line.
+type LimitError = interpreter.LimitError
+
+// RuntimeError is returned when a run stops on an error or because its
+// context is done, with the program line and input offset it had reached.
+type RuntimeError = interpreter.RuntimeError
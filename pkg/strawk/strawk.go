@@ -0,0 +1,147 @@
+// Package strawk compiles and runs strawk programs from Go.
+package strawk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ahalbert/strawk/pkg/ast"
+	"github.com/ahalbert/strawk/pkg/interpreter"
+	"github.com/ahalbert/strawk/pkg/lexer"
+	"github.com/ahalbert/strawk/pkg/parser"
+)
+
+// Program is a compiled strawk program. Each run gets its own interpreter
+// state, so a Program can be cached and run concurrently.
+type Program struct {
+	program *ast.Program
+	code    *interpreter.Bytecode
+	funcs   map[string]builtin
+}
+
+// ParseError lists the errors found while compiling a program.
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	var msgs []string
+	for _, err := range e.Errors {
+		msgs = append(msgs, strings.TrimSpace(err))
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Compile parses a program, returning a *ParseError if it is malformed.
+func Compile(src string) (*Program, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors) > 0 {
+		return nil, &ParseError{Errors: p.Errors}
+	}
+	if program == nil {
+		return nil, &ParseError{Errors: []string{"Parse Error on line 1: the program could not be parsed\n\n"}}
+	}
+	code := interpreter.Compile(program)
+	if errs := code.Resolution().Errors; len(errs) > 0 {
+		return nil, &ParseError{Errors: errs}
+	}
+	return &Program{program: program, code: code}, nil
+}
+
+// undefinedCalls reports calls to functions that neither the program nor
+// RegisterFunc define. It waits until the program runs since functions may be
+// registered after it is compiled.
+func (p *Program) undefinedCalls() error {
+	var errs []string
+	for _, call := range p.code.Resolution().Undefined {
+		if _, ok := p.funcs[call.Name]; !ok {
+			errs = append(errs, fmt.Sprintf("Error on line %d: function %s is not defined\n\n", call.Line, call.Name))
+		}
+	}
+	if len(errs) > 0 {
+		return &ParseError{Errors: errs}
+	}
+	return nil
+}
+
+// Option configures the interpreter for a single run.
+type Option func(*interpreter.Interpreter)
+
+// WithLimits bounds the resources the run may use.
+func WithLimits(limits Limits) Option {
+	return func(i *interpreter.Interpreter) { i.Limits = limits }
+}
+
+// WithSeed seeds the generator behind rand.
+func WithSeed(seed int64) Option {
+	return func(i *interpreter.Interpreter) { i.SeedRandom(seed) }
+}
+
+// MatchEvent describes a match of a rule's regex against the input.
+type MatchEvent = interpreter.MatchEvent
+
+// WithMatchHandler calls fn each time a rule's regex matches the input, with
+// the rule, the matched text, its capture groups and where they are in the
+// input. fn runs before the rule's action.
+func WithMatchHandler(fn func(MatchEvent)) Option {
+	return func(i *interpreter.Interpreter) { i.OnMatch = fn }
+}
+
+// WithWarnings writes warnings about the program found while it runs, such as
+// a rule whose regex matches the empty string, to w.
+func WithWarnings(w io.Writer) Option {
+	return func(i *interpreter.Interpreter) { i.Warnings = w }
+}
+
+// Instance is a Program prepared for a single run. Its variables can be set
+// before it runs and read once it has finished.
+type Instance struct {
+	prog   *Program
+	interp *interpreter.Interpreter
+	ran    bool
+}
+
+// NewInstance prepares a run of the program that writes its output to out.
+func (p *Program) NewInstance(out io.Writer, opts ...Option) *Instance {
+	i := interpreter.NewInterpreterFromBytecode(p.code, out)
+	for name, fn := range p.funcs {
+		i.StdLibFunctions[name] = fn
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return &Instance{prog: p, interp: i}
+}
+
+// Run runs the program over everything read from in, writing its output to
+// out. It stops early when ctx is done. The error is a *ParseError if the
+// program calls a function that is not defined, or a *RuntimeError or
+// *LimitError if the program did not run to completion.
+func (p *Program) Run(ctx context.Context, in io.Reader, out io.Writer, opts ...Option) error {
+	return p.NewInstance(out, opts...).Run(ctx, in)
+}
+
+// Run runs the instance over everything read from in. An instance can only
+// be run once.
+func (inst *Instance) Run(ctx context.Context, in io.Reader) error {
+	if inst.ran {
+		return errors.New("strawk: instance has already been run")
+	}
+	inst.ran = true
+	if err := inst.prog.undefinedCalls(); err != nil {
+		return err
+	}
+	var input []byte
+	if in != nil {
+		var err error
+		input, err = io.ReadAll(in)
+		if err != nil {
+			return err
+		}
+	}
+	return inst.interp.RunContext(ctx, string(input))
+}
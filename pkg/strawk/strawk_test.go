@@ -0,0 +1,182 @@
+package strawk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func mustCompile(t *testing.T, src string) *Program {
+	t.Helper()
+	p, err := Compile(src)
+	if err != nil {
+		t.Fatalf("Compile(%q): %v", src, err)
+	}
+	return p
+}
+
+func TestRunCancelsCommands(t *testing.T) {
+	for _, src := range []string{
+		`BEGIN { system("sleep 3"); print "done" }`,
+		`BEGIN { "sleep 3; echo hi" | getline x; print "done" }`,
+		`BEGIN { print "x" | "cat >/dev/null; sleep 3"; close("cat >/dev/null; sleep 3"); print "done" }`,
+		"function f(n) { return n }\nBEGIN { while (1) { f(1) } }",
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		var out bytes.Buffer
+		start := time.Now()
+		err := mustCompile(t, src).Run(ctx, strings.NewReader(""), &out)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: error %v, want the deadline", src, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: ran for %v after the deadline", src, elapsed)
+		}
+		if strings.Contains(out.String(), "done") {
+			t.Errorf("%s: carried on after the deadline", src)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		src    string
+		limits Limits
+		limit  string
+	}{
+		{`BEGIN { split("a b c d e f", a) }`, Limits{MaxArraySize: 5}, "array size"},
+		{`BEGIN { patsplit("a b c d e f", a) }`, Limits{MaxArraySize: 5}, "array size"},
+		{`BEGIN { match("abc", /(a)(b)/, m) }`, Limits{MaxArraySize: 5}, "array size"},
+		{`BEGIN { split("a b c d e f", a); asort(a, b) }`, Limits{MaxArraySize: 6}, ""},
+		{`BEGIN { system("sleep 3") }`, Limits{MaxDuration: 100 * time.Millisecond}, "time"},
+		{"function f(n) { return f(n + 1) }\nBEGIN { f(1) }", Limits{MaxCallDepth: 100}, "call depth"},
+		{`BEGIN { x = sprintf("%200d", 1) }`, Limits{MaxStringLength: 100}, "string length"},
+		{`BEGIN { x = sprintf("%.*f", 200, 1) }`, Limits{MaxStringLength: 100}, "string length"},
+		{`BEGIN { x = sprintf("%50.20f", 1) }`, Limits{MaxStringLength: 100}, ""},
+	}
+	for _, test := range tests {
+		err := mustCompile(t, test.src).Run(context.Background(), strings.NewReader(""), io.Discard, WithLimits(test.limits))
+		var limitErr *LimitError
+		switch {
+		case test.limit == "" && err != nil:
+			t.Errorf("%s: %v", test.src, err)
+		case test.limit != "" && (!errors.As(err, &limitErr) || limitErr.Limit != test.limit):
+			t.Errorf("%s: error %v, want the %s limit", test.src, err, test.limit)
+		}
+	}
+}
+
+func BenchmarkArithmetic(b *testing.B) {
+	p, err := Compile(`BEGIN { for (i = 0; i < 100000; i++) { x = x + i * 2 % 7; if (x > 1000) { x = x - 1000 } } }`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for range b.N {
+		if err := p.Run(context.Background(), strings.NewReader(""), io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRuntimeErrorIsReturnedNotPrinted(t *testing.T) {
+	var out bytes.Buffer
+	err := mustCompile(t, `BEGIN { print "before"; print 1 > "/nonexistent/file"; print "after" }`).Run(context.Background(), strings.NewReader(""), &out)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Line != 1 {
+		t.Errorf("error %v, want a runtime error on line 1", err)
+	}
+	if out.String() != "before\n" {
+		t.Errorf("output %q, want only what was printed before the error", out.String())
+	}
+}
+
+func TestSprintfWidthTooLarge(t *testing.T) {
+	for _, src := range []string{
+		`BEGIN { print sprintf("%1000001d", 1) }`,
+		`BEGIN { print sprintf("%.99999999999999999999f", 1) }`,
+		`BEGIN { print sprintf("%*d", -2000000, 1) }`,
+	} {
+		var out bytes.Buffer
+		err := mustCompile(t, src).Run(context.Background(), strings.NewReader(""), &out)
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || !strings.Contains(err.Error(), "is too large") {
+			t.Errorf("%s: error %v, want a runtime error", src, err)
+		}
+		if out.Len() > 0 {
+			t.Errorf("%s: printed %q", src, out.String())
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, src := range []string{"BEGIN { x = (1 }", "BEGIN { f() }\nfunction f(a) { a[1] = 1 }\nfunction f(b) { }"} {
+		_, err := Compile(src)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || len(parseErr.Errors) == 0 {
+			t.Errorf("Compile(%q) = %v, want a *ParseError", src, err)
+		}
+	}
+}
+
+func TestConcurrentRuns(t *testing.T) {
+	p := mustCompile(t, `/[a-z]+/ { words[$0]++; n++ } END { for (w in words) { total += words[w] }; print n, total, length(words) }`)
+	input := strings.Repeat("the quick brown fox jumps over the lazy dog ", 200)
+	var wg sync.WaitGroup
+	outputs := make([]string, 16)
+	for idx := range outputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var out bytes.Buffer
+			if err := p.Run(context.Background(), strings.NewReader(input), &out); err != nil {
+				t.Error(err)
+			}
+			outputs[idx] = out.String()
+		}()
+	}
+	wg.Wait()
+	for idx, out := range outputs {
+		if out != "1800 1800 8\n" {
+			t.Errorf("run %d printed %q", idx, out)
+		}
+	}
+}
+
+func TestInstanceRunsOnce(t *testing.T) {
+	inst := mustCompile(t, `BEGIN { print "hi" }`).NewInstance(io.Discard)
+	if err := inst.Run(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := inst.Run(context.Background(), nil); err == nil {
+		t.Error("a second run of an instance succeeded")
+	}
+}
+
+func TestMatchHandler(t *testing.T) {
+	p := mustCompile(t, `BEGIN { }
+/(?P<key>[a-z]+)=([0-9]+)/ { }
+/#(x)?[0-9]+/ { }
+`)
+	var events []MatchEvent
+	err := p.Run(context.Background(), strings.NewReader("a=1\nbb=22 #7"), io.Discard, WithMatchHandler(func(event MatchEvent) {
+		events = append(events, event)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MatchEvent{
+		{Rule: 0, RuleLine: 2, Text: "a=1", Groups: []string{"a=1", "a", "1"}, Names: []string{"", "key", ""}, Start: 0, End: 3, Spans: []int{0, 3, 0, 1, 2, 3}},
+		{Rule: 0, RuleLine: 2, Text: "bb=22", Groups: []string{"bb=22", "bb", "22"}, Names: []string{"", "key", ""}, Start: 4, End: 9, Spans: []int{4, 9, 4, 6, 7, 9}},
+		{Rule: 1, RuleLine: 3, Text: "#7", Groups: []string{"#7", ""}, Names: []string{"", ""}, Start: 10, End: 12, Spans: []int{10, 12, -1, -1}},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events:\n%+v\nwant:\n%+v", events, want)
+	}
+}
@@ -0,0 +1,66 @@
+package strawk
+
+import (
+	"github.com/ahalbert/strawk/pkg/ast"
+	"github.com/ahalbert/strawk/pkg/interpreter"
+)
+
+// Value is a strawk scalar, either a string or a number, passed to and
+// returned from Go functions.
+type Value struct {
+	str   string
+	num   float64
+	isNum bool
+}
+
+// Str returns a string value.
+func Str(s string) Value { return Value{str: s} }
+
+// Num returns a numeric value.
+func Num(n float64) Value { return Value{num: n, isNum: true} }
+
+// IsNum reports whether v holds a number rather than a string.
+func (v Value) IsNum() bool { return v.isNum }
+
+// String returns v as strawk would print it.
+func (v Value) String() string {
+	if v.isNum {
+		return (&ast.NumericLiteral{Value: v.num}).String()
+	}
+	return v.str
+}
+
+// Float returns v as a number, converting strings the way strawk does.
+func (v Value) Float() float64 {
+	if v.isNum {
+		return v.num
+	}
+	return interpreter.StringToNumber(v.str)
+}
+
+// Bool returns v as a condition, as interpreter.ExpressionToBool does: false
+// for the number 0, the string "0" and the empty string, true otherwise.
+func (v Value) Bool() bool {
+	if v.isNum {
+		return v.num != 0
+	}
+	return v.str != "" && v.str != "0"
+}
+
+func valueFromExpression(expr ast.Expression) (Value, bool) {
+	switch expr := expr.(type) {
+	case *ast.NumericLiteral:
+		return Num(expr.Value), true
+	case *ast.StringLiteral:
+		return Str(expr.Value), true
+	default:
+		return Value{}, false
+	}
+}
+
+func (v Value) expression() ast.Expression {
+	if v.isNum {
+		return &ast.NumericLiteral{Value: v.num}
+	}
+	return &ast.StringLiteral{Value: v.str}
+}
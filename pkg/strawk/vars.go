@@ -0,0 +1,100 @@
+package strawk
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"github.com/ahalbert/strawk/pkg/ast"
+)
+
+// SetVar sets a global variable before the instance runs. Strings, numbers,
+// bools and Values become scalars. Maps become arrays keyed by their keys,
+// and slices become arrays indexed from 1, as split() makes them. Maps and
+// slices may nest.
+func (inst *Instance) SetVar(name string, value any) error {
+	expr, err := toExpression(reflect.ValueOf(value))
+	if err != nil {
+		return fmt.Errorf("variable %s: %w", name, err)
+	}
+	inst.interp.SetGlobal(name, expr)
+	return nil
+}
+
+// GetVar returns a global variable after the instance has run. Strings are
+// returned as string, numbers as float64 and arrays as map[string]any.
+func (inst *Instance) GetVar(name string) (any, bool) {
+	expr := inst.interp.GetGlobal(name)
+	if expr == nil {
+		return nil, false
+	}
+	return fromExpression(expr), true
+}
+
+func toExpression(v reflect.Value) (ast.Expression, error) {
+	if !v.IsValid() {
+		return nil, fmt.Errorf("cannot convert nil")
+	}
+	if isScalarType(v.Type()) {
+		return fromGo(v).expression(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		return toExpression(v.Elem())
+	case reflect.Map:
+		if !isScalarType(v.Type().Key()) || v.Type().Key() == valueType {
+			return nil, fmt.Errorf("unsupported map key type %v", v.Type().Key())
+		}
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return compareKeys(fromGo(a), fromGo(b))
+		})
+		array := ast.NewAssociativeArray()
+		for _, key := range keys {
+			elem, err := toExpression(v.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			array.Set(fromGo(key).String(), elem)
+		}
+		return array, nil
+	case reflect.Slice, reflect.Array:
+		array := ast.NewAssociativeArray()
+		for idx := range v.Len() {
+			elem, err := toExpression(v.Index(idx))
+			if err != nil {
+				return nil, err
+			}
+			array.Set(strconv.Itoa(idx+1), elem)
+		}
+		return array, nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", v.Type())
+}
+
+// compareKeys orders map keys numerically if they are numbers and as
+// strings otherwise, so that arrays made from maps iterate predictably.
+func compareKeys(a, b Value) int {
+	if a.IsNum() && b.IsNum() {
+		return cmp.Compare(a.Float(), b.Float())
+	}
+	return cmp.Compare(a.String(), b.String())
+}
+
+func fromExpression(expr ast.Expression) any {
+	if array, ok := expr.(*ast.AssociativeArray); ok {
+		m := make(map[string]any, len(array.Array))
+		for k, elem := range array.Array {
+			m[k] = fromExpression(elem)
+		}
+		return m
+	}
+	v, _ := valueFromExpression(expr)
+	if v.IsNum() {
+		return v.Float()
+	}
+	return v.String()
+}
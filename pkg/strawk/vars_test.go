@@ -0,0 +1,70 @@
+package strawk
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetVar(t *testing.T) {
+	var out bytes.Buffer
+	inst := mustCompile(t, `BEGIN {
+  print name, count + 1, flag, v
+  for (k in byName) { print k, byName[k] }
+  print list[1], list[3], length(list)
+  print nested["a"][2]
+}`).NewInstance(&out)
+	x := 7.5
+	for name, value := range map[string]any{
+		"name":   "ann",
+		"count":  41,
+		"flag":   true,
+		"v":      &x,
+		"byName": map[string]int{"b": 2, "a": 1},
+		"list":   []any{"x", 2, Str("z")},
+		"nested": map[string][]string{"a": {"p", "q"}},
+	} {
+		if err := inst.SetVar(name, value); err != nil {
+			t.Fatalf("SetVar(%q): %v", name, err)
+		}
+	}
+	if err := inst.Run(context.Background(), strings.NewReader("")); err != nil {
+		t.Fatal(err)
+	}
+	want := "ann 42 1 7.5\na 1\nb 2\nx z 3\nq\n"
+	if out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+}
+
+func TestSetVarErrors(t *testing.T) {
+	inst := mustCompile(t, `BEGIN { }`).NewInstance(&bytes.Buffer{})
+	for _, value := range []any{nil, struct{}{}, map[Value]int{}, []func(){nil}, make(chan int)} {
+		if err := inst.SetVar("x", value); err == nil {
+			t.Errorf("SetVar(%#v) succeeded", value)
+		}
+	}
+}
+
+func TestGetVar(t *testing.T) {
+	inst := mustCompile(t, `BEGIN { s = "str"; n = 3; split("a b", parts); m["k"]["j"] = 1 }`).NewInstance(&bytes.Buffer{})
+	if err := inst.Run(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]any{
+		"s":     "str",
+		"n":     3.0,
+		"parts": map[string]any{"1": "a", "2": "b"},
+		"m":     map[string]any{"k": map[string]any{"j": 1.0}},
+	} {
+		got, ok := inst.GetVar(name)
+		if !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("GetVar(%q) = %#v, %v, want %#v", name, got, ok, want)
+		}
+	}
+	if got, ok := inst.GetVar("unset"); ok {
+		t.Errorf("GetVar of an unset variable = %#v", got)
+	}
+}
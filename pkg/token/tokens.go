@@ -7,6 +7,7 @@ type Token struct {
 	Literal  string
 	LineNum  int
 	Position int
+	Offset   int // byte offset of the token's first character in the input
 }
 
 const (
@@ -21,6 +22,10 @@ const (
 	NEWLINE = "\n"
 	COMMENT = "COMMENT"
 
+	// Runs of spaces, tabs and carriage returns, only returned by a lexer
+	// emitting trivia
+	WHITESPACE = "WHITESPACE"
+
 	//symbols
 
 	ESCAPED_SLASH = "\\"
@@ -31,6 +36,7 @@ const (
 	RBRACE        = "}"
 	LBRACKET      = "["
 	RBRACKET      = "]"
+	DOLLAR        = "$"
 
 	BANG = "!"
 	AND  = "&&"
@@ -57,10 +63,12 @@ const (
 	TERNARY = "?"
 	COLON   = ":"
 
-	LT   = "<"
-	GT   = ">"
-	LTEQ = "<="
-	GTEQ = ">="
+	LT     = "<"
+	GT     = ">"
+	LTEQ   = "<="
+	GTEQ   = ">="
+	APPEND = ">>"
+	PIPE   = "|"
 
 	EQ     = "=="
 	NOT_EQ = "!="
@@ -84,6 +92,7 @@ const (
 	RETURN   = "RETURN"
 	FUNCTION = "FUNCTION"
 	DELETE   = "DELETE"
+	GETLINE  = "GETLINE"
 )
 
 var keywords = map[string]TokenType{
@@ -102,6 +111,7 @@ var keywords = map[string]TokenType{
 	"function": FUNCTION,
 	"return":   RETURN,
 	"delete":   DELETE,
+	"getline":  GETLINE,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -1,17 +1,31 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 
 	"github.com/ahalbert/strawk/pkg/flags"
+	"github.com/ahalbert/strawk/pkg/format"
 	"github.com/ahalbert/strawk/pkg/interpreter"
 	"github.com/ahalbert/strawk/pkg/lexer"
+	"github.com/ahalbert/strawk/pkg/lint"
+	"github.com/ahalbert/strawk/pkg/lsp"
 	"github.com/ahalbert/strawk/pkg/parser"
+	"github.com/ahalbert/strawk/pkg/strawk"
 	"github.com/alexflint/go-arg"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "lsp" {
+		// editors may pass --stdio, the only transport there is
+		if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	arg.MustParse(&flags.Flags)
 
@@ -32,20 +46,96 @@ func main() {
 	if program == "" {
 		panic("no program supplied")
 	}
+	if flags.Flags.Lint {
+		os.Exit(lintProgram(program))
+	}
+	if flags.Flags.Fmt {
+		os.Exit(formatProgram(program))
+	}
 
 	var input []byte
 	if len(flags.Flags.InputFiles) > 0 {
 		input, _ = os.ReadFile(flags.Flags.InputFiles[0])
 	}
-	l := lexer.New(string(program))
-	p := parser.New(l)
-	parsedprogram := p.ParseProgram()
-	if len(p.Errors) > 0 {
-		for _, err := range p.Errors {
-			fmt.Print(err)
+	prog, err := strawk.Compile(program)
+	if err != nil {
+		for _, msg := range err.(*strawk.ParseError).Errors {
+			fmt.Print(msg)
+		}
+		os.Exit(1)
+	}
+	limits := strawk.Limits{
+		MaxSteps:        flags.Flags.MaxSteps,
+		MaxDuration:     flags.Flags.Timeout,
+		MaxOutputBytes:  flags.Flags.MaxOutputBytes,
+		MaxArraySize:    flags.Flags.MaxArraySize,
+		MaxStringLength: flags.Flags.MaxStringLength,
+		MaxCallDepth:    flags.Flags.MaxCallDepth,
+		DisableIO:       flags.Flags.Sandbox,
+	}
+	err = prog.Run(context.Background(), bytes.NewReader(input), os.Stdout, strawk.WithSeed(flags.Flags.Seed), strawk.WithLimits(limits), strawk.WithWarnings(os.Stderr))
+	if perr, ok := err.(*strawk.ParseError); ok {
+		for _, msg := range perr.Errors {
+			fmt.Print(msg)
 		}
 		os.Exit(1)
 	}
-	i := interpreter.NewInterpreter(parsedprogram, os.Stdout)
-	i.Run(string(input))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+// lintProgram prints the errors and warnings found in a program, returning
+// the exit status: 1 if there were any, 0 otherwise.
+func lintProgram(program string) int {
+	p := parser.New(lexer.New(program))
+	prog := p.ParseProgram()
+	errs := p.Errors
+	if len(errs) == 0 {
+		errs = interpreter.Resolve(prog).Errors
+	}
+	if len(errs) > 0 {
+		for _, msg := range errs {
+			fmt.Print(msg)
+		}
+		return 1
+	}
+	warnings := lint.Lint(prog)
+	for _, w := range warnings {
+		fmt.Println(w)
+	}
+	if len(warnings) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// formatProgram prints a program in canonical layout, or writes it back to
+// the program file with -w, returning the exit status.
+func formatProgram(program string) int {
+	formatted, err := format.Source(program)
+	if err != nil {
+		for _, msg := range err.(*strawk.ParseError).Errors {
+			fmt.Print(msg)
+		}
+		return 1
+	}
+	if !flags.Flags.Write {
+		fmt.Print(formatted)
+		return 0
+	}
+	if flags.Flags.ProgramFile == "" {
+		fmt.Fprintln(os.Stderr, "-w needs a program file given with -f")
+		return 2
+	}
+	info, err := os.Stat(flags.Flags.ProgramFile)
+	if err == nil {
+		err = os.WriteFile(flags.Flags.ProgramFile, []byte(formatted), info.Mode().Perm())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	return 0
 }
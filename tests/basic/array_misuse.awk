@@ -0,0 +1,8 @@
+# a is used as an array and then, on the same line, as a scalar, which is
+# reported at the scalar use before the program runs
+BEGIN {
+  print "never printed"
+}
+END {
+  print a[1], a
+}
@@ -0,0 +1,65 @@
+function by_length(i1, v1, i2, v2) {
+  if (length(v1) != length(v2)) {
+    return length(v1) - length(v2)
+  }
+  return i1 < i2 ? -1 : i1 != i2
+}
+
+function sign(n) {
+  if (n < 0) {
+    return -1
+  }
+  if (n == 0) {
+    return
+  }
+  return 1
+}
+
+function fill(arr, n,    k) {
+  for (k = 1; k <= n; k++) {
+    arr[k] = k * k
+  }
+  return n
+}
+
+function dump(arr,    k, out) {
+  out = ""
+  for (k in arr) {
+    out = out " " k "=" arr[k]
+  }
+  print out
+}
+
+BEGIN {
+  a["pear"] = 3
+  a["fig"] = 10
+  a["banana"] = 2
+  a["apple"] = "x"
+  a["cherry"] = 25
+  dump(a)
+
+  delete a["fig"]
+  a["fig"] = 1
+  dump(a)
+
+  PROCINFO["sorted_in"] = "@ind_str_asc"
+  dump(a)
+  PROCINFO["sorted_in"] = "@ind_str_desc"
+  dump(a)
+  PROCINFO["sorted_in"] = "@val_type_asc"
+  dump(a)
+  PROCINFO["sorted_in"] = "@val_str_desc"
+  dump(a)
+  PROCINFO["sorted_in"] = "by_length"
+  dump(a)
+  PROCINFO["sorted_in"] = "@unsorted"
+  dump(a)
+
+  n = asort(a, sorted, "@val_str_asc")
+  dump(sorted)
+
+  print sign(-5), sign(0) "", sign(7)
+  x = 4
+  print fill(squares, x), length(squares)
+  dump(squares)
+}
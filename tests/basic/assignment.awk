@@ -0,0 +1,39 @@
+function next_value() {
+  n--
+  return n
+}
+
+BEGIN {
+  a = b = 3
+  print a, b
+  x = 1
+  x += y = 4
+  print x, y
+  z = 10
+  z -= 2
+  z *= 3
+  z /= 4
+  z %= 4
+  z ^= 3
+  print z
+  print (m = 5) * 2, m
+  k += (j = 3)
+  print k, j
+  n = 4
+  total = 0
+  while ((v = next_value()) > 0) {
+    total += v
+  }
+  print total
+  arr[1] = 1
+  i = 1
+  arr[i++] += 5
+  print arr[1], i
+  p, q = 1, 2
+  print p, q
+  0 && (w = 1)
+  1 || (w = 2)
+  print "w" w
+  c = 1 ? "yes" : "no"
+  print c
+}
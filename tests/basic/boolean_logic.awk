@@ -2,4 +2,7 @@ BEGIN {
   print !"1"
   print "1" && "0"
   print "1" || "0"
+  print !"", !unset, !"a", !0
+  print "" || 0, "a" && 1
+  if (unset) { print "unset is true" } else { print "unset is false" }
 }
@@ -0,0 +1,9 @@
+# comments are skipped, but a # inside a regex is matched
+BEGIN {
+  x = 4 / 2 # half/whole
+  print x
+}
+/#[0-9]+/ {
+  print "issue", $0
+}
+# a comment ending the program without a newline
\ No newline at end of file
@@ -1,7 +1,7 @@
 BEGIN {
   print "a" == "b", 1 == 1, 1==2, "1" == 1
   print "a" != "b", 1 != 1, 1 != 2, "1" != 1
-  print "a" > "b", 1 > 1, 1 > 2, "1" > 1
+  print ("a" > "b"), (1 > 1), (1 > 2), ("1" > 1)
   print "a" >= "b", 1 >= 1, 1 >= 2, "1" >= 1
   print "a" < "b", 1 < 1, 1 < 2, "1" < 1
   print "a" <= "b", 1 <= 1, 1 <= 2, "1" <= 1
@@ -0,0 +1,42 @@
+function reset(arr) {
+  delete arr
+}
+
+BEGIN {
+  grid[1, 2] = "a"
+  grid[2, 1] = "b"
+  keys[1] = 2
+  print ((1, 2) in grid), ((2, 2) in grid), (keys[1], 1) in grid
+  if ((2, 1) in grid) {
+    print "found", grid[2, 1]
+  }
+
+  delete grid[1, 2]
+  print length(grid), ((1, 2) in grid)
+  delete grid[5, 5]
+  print length(grid)
+
+  delete grid
+  print length(grid), ((2, 1) in grid)
+  grid[3, 3] = "c"
+  print length(grid)
+
+  nested["x"]["y"] = 1
+  nested["x"]["z"] = 2
+  delete nested["x"]["y"]
+  print length(nested), length(nested["x"])
+  delete nested["x"]
+  print length(nested)
+
+  delete never_set
+  print length(never_set)
+}
+
+/(\w+)=(\w+)/ {
+  seen[$1] = $2
+  if ($1 == "end") {
+    print length(seen), seen["a"], seen["b"]
+    reset(seen)
+    print length(seen)
+  }
+}
@@ -0,0 +1,12 @@
+# x* matches the empty string before every other character, which the rule
+# skips with a warning, so it only fires on runs of x
+/x*/ {
+  print "x run:", $0
+}
+# a match keeps growing while input remains, up to its end
+/[a-z]+$/ {
+  print "word:", $0
+}
+END {
+  print "done"
+}
@@ -0,0 +1,6 @@
+/[a-z]+=[0-9]+/ {
+  print $0
+}
+END {
+  print "done"
+}
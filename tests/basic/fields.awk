@@ -0,0 +1,15 @@
+function first() {
+  return $1
+}
+
+/(\w+)=(\w+);/ {
+  for (i = 0; i <= 2; i++) {
+    print i, $i
+  }
+  n = 1
+  print $(n+1), $n $n, first()
+  $2 = "<" $2 ">"
+  print $0, $1, $2
+  $1 = "k"
+  print $0
+}
@@ -0,0 +1,27 @@
+BEGIN {
+  s = "hello world, hello strawk"
+  print gensub(/hello/, "bye", "g", s)
+  print gensub(/hello/, "bye", 2, s)
+  print gensub(/(h)(ello)/, "\\2-\\1 [&]", "g", s)
+  print s
+
+  n = patsplit("  one two  three ", parts, /[a-z]+/, seps)
+  print n, parts[1], parts[2], parts[3]
+  print "[" seps[0] "][" seps[1] "][" seps[2] "][" seps[3] "]"
+
+  vals["x"] = "pear"
+  vals["y"] = 10
+  vals["z"] = "apple"
+  vals["w"] = 2
+  n = asort(vals, sorted)
+  print n, sorted[1], sorted[2], sorted[3], sorted[4]
+  n = asorti(vals, keys)
+  print n, keys[1], keys[2], keys[3], keys[4]
+  asort(vals)
+  print vals[1], vals[2], vals[3], vals[4]
+
+  print strftime("%Y-%m-%d %H:%M:%S %j %a %B", 0, 1)
+  print strftime("%F %T %p %I %e|%y %U %W %V %u %w", 1700000000, 1)
+  print mktime("2023 11 14 22 13 20", 1), mktime("bad date", 1)
+  print (systime() > 1700000000)
+}
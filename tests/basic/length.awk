@@ -0,0 +1,12 @@
+# length without an argument, with or without parentheses, is the length
+# of $0
+/[a-z]+/ {
+  print $0, length, length(), length($0)
+  if (length > 3) {
+    print "long"
+  }
+}
+END {
+  split("a b c", parts)
+  print length("four"), length(12.5), length(parts)
+}
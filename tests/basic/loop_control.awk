@@ -0,0 +1,40 @@
+function first_even(arr,   k) {
+  for (k in arr) {
+    if (arr[k] % 2 == 0) {
+      return k
+    }
+  }
+  return "none"
+}
+
+BEGIN {
+  for (i = 0; i < 10; i++) {
+    if (i % 2) {
+      continue
+    }
+    if (i > 6) {
+      break
+    }
+    evens = evens " " i
+  }
+  print evens
+
+  n = 0
+  while (1) {
+    n++
+    if (n == 5) {
+      break
+    }
+  }
+  print n
+
+  split("3 5 8 9", nums)
+  print first_even(nums)
+
+  for (k in nums) {
+    if (nums[k] > 4) {
+      print "first over 4:", nums[k]
+      break
+    }
+  }
+}
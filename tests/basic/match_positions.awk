@@ -0,0 +1,10 @@
+BEGIN {
+  print match("foobarbaz", /ba./), RSTART, RLENGTH
+  print match("foobarbaz", "x+"), RSTART, RLENGTH
+  print match("key=value", /(\w+)=(?P<val>\w+)/, m), m[0], m[1], m[2], m["val"]
+  print m[1, "start"], m[1, "length"], m[2, "start"], m[2, "length"]
+}
+
+/TODO[^\n]*/ {
+  print $OFFSET, $LINE, $COLUMN, $0
+}
@@ -0,0 +1,10 @@
+BEGIN {
+  print sin(0), cos(0), atan2(0, -1), exp(1), log(exp(2)), sqrt(16)
+  print int(3.9), int(-3.9), int("42abc")
+  srand(7)
+  a = rand()
+  b = rand()
+  print srand(7), a < 1, a >= 0, a != b
+  print rand() == a, rand() == b
+  print srand(), 0
+}
@@ -0,0 +1,6 @@
+/(?P<level>[A-Z]+) (?P<host>[a-z]+)(:(?P<port>\d+))?: (?P<msg>[^\n]*)\n/ {
+  print $level, $host, $port, $msg
+  print $MATCHES["level"], $MATCHES["$1"], $RSTART["host"], $RLENGTH["host"], $RSTART["port"], $RLENGTH["port"]
+  $host = "redacted"
+  print $MATCHES["$0"] == $0, length($0), $RSTART["msg"], $msg
+}
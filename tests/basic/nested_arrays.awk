@@ -0,0 +1,38 @@
+function total(row,    k, sum) {
+  sum = 0
+  for (k in row) {
+    sum += row[k]
+  }
+  return sum
+}
+
+BEGIN {
+  sales["east"]["jan"] = 10
+  sales["east"]["feb"] = 5
+  sales["west"]["jan"] = 7
+  sales["west"]["mar"] += 3
+  sales["west"]["mar"]++
+
+  for (region in sales) {
+    print region, isarray(sales[region]), length(sales[region]), total(sales[region])
+    for (month in sales[region]) {
+      print "  " month, sales[region][month]
+    }
+  }
+  print isarray(sales), isarray(sales["east"]["jan"]), "jan" in sales["west"], "feb" in sales["west"]
+
+  delete sales["east"]["jan"]
+  print length(sales["east"]), ("east" in sales)
+
+  n = split("a:b:c", parts["letters"], ":")
+  print n, parts["letters"][3]
+
+  grid[1, 2] = "x"
+  for (k in grid) {
+    split(k, idx, SUBSEP)
+    print idx[1], idx[2], grid[1, 2]
+  }
+  SUBSEP = ":"
+  grid[3, 4] = "y"
+  print ("3:4" in grid), grid["3:4"]
+}
@@ -0,0 +1,31 @@
+BEGIN {
+  "mktemp" | getline tmp
+  close("mktemp")
+  print "banana" > tmp
+  print "apple" > tmp
+  print "cherry" >> tmp
+  print close(tmp), close(tmp)
+
+  while ((getline line < tmp) > 0) {
+    print "read", line
+  }
+  close(tmp)
+
+  print "c" | "sort"
+  print "a" | "sort"
+  print "b" | "sort"
+  print close("sort")
+
+  "printf 'x y\\nz\\n'" | getline first
+  "printf 'x y\\nz\\n'" | getline second
+  print first "|" second, ("printf 'x y\\nz\\n'" | getline third), length(third)
+
+  cmd = "echo " "joined"
+  cmd | getline
+  print
+  close(cmd)
+
+  print system("exit 3"), system("echo from system")
+  print (getline missing < "/nonexistent/file")
+  system("rm -f " tmp)
+}
@@ -0,0 +1,15 @@
+BEGIN {
+  x = 3
+  arr["a"] = 1
+  print -2^2, 2^3^2, -x^2, 2^-1
+  print 2+3*4, (2+3)*4, 10-4-3, 100/10/5, 7%4*2
+  print -x+1, - -x, +"3", -"4", !x, !0, !x+1
+  print 1 " " 2+3, 1 2*3, 1+2 3
+  print 1 < 2 "", 2 < 10, "2" < "10"
+  print "x" "ab" ~ /^xa/, !("ab" ~ /c/)
+  print "a" in arr, "b" in arr, "a" in arr && 1, "b" in arr || 1
+  print 1 || 0 && 0, (1 || 0) && 0
+  print 1 ? "a" : 0 ? "b" : "c", 0 ? "a" : 0 ? "b" : "c"
+  print 1 + 1 == 2 ? "yes" : "no", (2 < 1 || 1 < 2)
+  print x++ + ++x, x, x-- - --x, x
+}
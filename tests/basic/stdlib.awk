@@ -5,7 +5,24 @@ BEGIN {
   b[3] = 3
   print a, length(a)
   print length(b)
-  print sub(/abc/, "789", a)
+  print sub(/abc/, "789", a), a
   c="123abc456xyzabc"
-  print gsub(/abc/, "789", c)
+  print gsub(/abc/, "789", c), c
+  d = "hello world"
+  print gsub(/o/, "[&]", d), d
+  e = "a.b.c"
+  print gsub(/\./, "\\&", e), e
+  print sub(/x/, "y", e), e
+  print substr("hello", 2, 3), substr("hello", 0), substr("hello", -1, 3), substr("hello", 4, 10) "|" substr("hello", 9) "|"
+  print index("hello", "ll"), index("hello", "z")
+  n = split("a b  c", parts)
+  print n, parts[1], parts[2], parts[3]
+  n = split("1,2,,3", parts, ",")
+  print n, parts[1], parts[2], parts[3], parts[4], length(parts)
+  n = split("x1y22z", parts, /[0-9]+/)
+  print n, parts[1], parts[2], parts[3]
+  print split("", parts), length(parts)
+  print sprintf("%5.2f|%-4d|%x|%o|%c|%c|%s|%5s|%-5s|%%|%e", 3.14159, 42, 255, 8, 65, "hello", "str", "ab", "cd", 12345.678)
+  print sprintf("%*d|%.3s|%+d|%05d|%i|%u|%G", 4, 7, "abcdef", 5, 42, 3.9, 3, 0.0001)
+  print tolower("ABC"), toupper("abc")
 }
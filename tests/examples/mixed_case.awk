@@ -2,11 +2,12 @@ BEGIN { sentence = 0}
 
 /(?s)(.*)\./ { 
   sentence++
-  s = sub(/\n/, "", $1)
+  s = $1
+  sub(/\n/, "", s)
   if sentence == 4 {
     new_sentence = ""
-    for (char = 0; char < length(s); char++) {
-      if char % 2  == 0 {
+    for (char = 1; char <= length(s); char++) {
+      if char % 2  == 1 {
         c = toupper(substr(s, char, 1))
       } else {
         c = tolower(substr(s, char, 1))